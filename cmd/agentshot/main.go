@@ -3,7 +3,7 @@
 // Usage:
 //
 //	agentshot browser [options] <url>    - Capture web page screenshot
-//	agentshot tui [options] <command>    - Capture terminal output as SVG
+//	agentshot tui [options] <command>    - Capture terminal output as SVG or PNG
 //
 // Examples:
 //
@@ -51,7 +51,7 @@ Usage:
 
 Commands:
   browser, b    Capture web page screenshot (PNG)
-  tui, t        Capture terminal output (SVG)
+  tui, t        Capture terminal output (SVG or PNG)
   version       Show version
   help          Show this help
 
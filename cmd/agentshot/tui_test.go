@@ -1,10 +1,25 @@
 package main
 
 import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
 )
 
 func TestTUIScreenshot(t *testing.T) {
@@ -74,6 +89,27 @@ func TestTUIScreenshot(t *testing.T) {
 			os.Remove(outputPath)
 		})
 	}
+
+	sizeTests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"-cols", "0"}, want: "must be at least 1"},
+		{args: []string{"-rows", "0"}, want: "must be at least 1"},
+		{args: []string{"-cols", "-1"}, want: "must be at least 1"},
+		{args: []string{"-font-size", "0"}, want: "must be from 1 to 200"},
+		{args: []string{"-font-size", "-5", "-format", "gif"}, want: "must be from 1 to 200"},
+		{args: []string{"-font-size", "1000", "-format", "png"}, want: "must be from 1 to 200"},
+	}
+	for _, tt := range sizeTests {
+		args := append([]string{"tui", "-o", "-"}, tt.args...)
+		cmd := exec.Command("./agentshot_test_bin", args...)
+		cmd.Stdin = strings.NewReader("hi\n")
+		output, err := cmd.CombinedOutput()
+		if err == nil || !strings.Contains(string(output), tt.want) {
+			t.Errorf("%v should be rejected, got: %v\n%s", tt.args, err, output)
+		}
+	}
 }
 
 func TestTUIStdout(t *testing.T) {
@@ -159,6 +195,44 @@ func TestTUIPipeInput(t *testing.T) {
 	os.Remove(outputPath)
 }
 
+func TestTUILineFeed(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// A line feed only moves down. The PTY adds the carriage return unless
+	// the program turns ONLCR off, as curses programs do, and piped input
+	// gets one added for it.
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{name: "piped", input: "abc\ndef", want: "abc\ndef\n"},
+		{name: "pty", args: []string{"printf 'abc\\ndef'"}, want: "abc\ndef\n"},
+		{name: "pty without onlcr", args: []string{"stty -opost; printf 'abc\\ndef\\vg\\fh'"}, want: "abc\n   def\n      g\n       h\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "txt", "-rows", "5"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			if tt.input != "" {
+				cmd.Stdin = strings.NewReader(tt.input)
+			}
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Got %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
 func TestTUIAutoOutputPath(t *testing.T) {
 	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
 	if err := buildCmd.Run(); err != nil {
@@ -185,3 +259,1909 @@ func TestTUIAutoOutputPath(t *testing.T) {
 
 	os.Remove(outputPath)
 }
+
+func TestTUIEscapeSequences(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// OSC, DCS, private-mode CSI and charset designations must not leak.
+	input := "\x1b]0;window title\x07\x1b[?25l\x1b(Bhello\x1bP1$r0m\x1b\\ world\x1b[3:4m"
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	svg := string(output)
+	if !strings.Contains(svg, "hello world") {
+		t.Error("Output should contain 'hello world'")
+	}
+	for _, leaked := range []string{"window title", "?25l", "(B", "$r", "3:4m"} {
+		if strings.Contains(svg, leaked) {
+			t.Errorf("Escape sequence leaked into output: %q", leaked)
+		}
+	}
+}
+
+func TestTUILargeOutput(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Output is streamed through the emulator, so only the final screen remains.
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-rows", "5", "seq 1 200000")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	svg := string(output)
+	if !strings.Contains(svg, ">200000<") {
+		t.Error("Output should contain the last line of output")
+	}
+	if strings.Contains(svg, ">199990<") {
+		t.Error("Output should not contain lines scrolled off the screen")
+	}
+}
+
+func TestTUIAlternateScreen(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// A full-screen app draws on the alternate screen, then restores the shell.
+	input := "shell_prompt\n\x1b[?1049h\x1b[2J\x1b[Happ_frame\x1b[?1049lafter_exit"
+
+	tests := []struct {
+		buffer  string
+		want    []string
+		notWant []string
+	}{
+		{"active", []string{"shell_prompt", "after_exit"}, []string{"app_frame"}},
+		{"primary", []string{"shell_prompt", "after_exit"}, []string{"app_frame"}},
+		{"alternate", []string{"app_frame"}, []string{"shell_prompt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.buffer, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-buffer", tt.buffer)
+			cmd.Stdin = strings.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q", s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(output), s) {
+					t.Errorf("Output should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestTUIScrollRegion(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Pager-style layout: fixed header and footer around a scrolling region,
+	// then a line inserted at the top of the region via reverse index.
+	input := "\x1b[1;1Hheader_line\x1b[5;1Hfooter_line\x1b[2;4r\x1b[4;1H" +
+		"one\ntwo\nthree\nfour\x1b[2;1H\x1bMinserted"
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "5")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	svg := string(output)
+	for _, want := range []string{"header_line", "footer_line", ">inserted<", ">three<"} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("Output should contain %q", want)
+		}
+	}
+	for _, notWant := range []string{">one<", ">four<"} {
+		if strings.Contains(svg, notWant) {
+			t.Errorf("Output should not contain %q", notWant)
+		}
+	}
+}
+
+func TestTUIWideCharacters(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Two wide characters occupy four cells, so "end" starts at column 4
+	// (padding 20 + 4 * 8.4 at the default 14px font size).
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader("日😀end")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	if !regexp.MustCompile(`<text x="53.6"[^>]*>end<`).Match(output) {
+		t.Errorf("Text after wide characters should be aligned to column 4:\n%s", output)
+	}
+
+	// Editing half of a wide character blanks all of it, so the text keeps
+	// to the width of the grid.
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "erase lead", input: "中文x\x1b[1G\x1b[1X", want: "  文x\n"},
+		{name: "erase continuation", input: "中文x\x1b[2G\x1b[1X", want: "  文x\n"},
+		{name: "insert at continuation", input: "ab中文\x1b[4G\x1b[1@", want: "ab\n"},
+		{name: "insert past edge", input: "ab中文\x1b[1G\x1b[1@", want: " ab中\n"},
+		{name: "delete continuation", input: "中文x\x1b[2G\x1b[1P", want: " 文x\n"},
+		{name: "delete lead", input: "中文x\x1b[1G\x1b[1P", want: " 文x\n"},
+		{name: "erase line to cursor", input: "中文xy\x1b[3G\x1b[1K", want: "    xy\n"},
+		{name: "erase line from cursor", input: "x中文y\x1b[3G\x1b[K", want: "x\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-cols", "6", "-rows", "1", "-format", "txt", "-o", "-")
+			cmd.Stdin = strings.NewReader(tt.input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Got %q, want %q", output, tt.want)
+			}
+		})
+	}
+}
+
+func TestTUIGraphemeClusters(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// "e" + combining acute takes one cell, the flag (two regional
+	// indicators) takes two, so "|end" starts at column 3.
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader("e\u0301\U0001F1EF\U0001F1F5|end")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	if !strings.Contains(string(output), ">e\u0301<") {
+		t.Error("Combining mark should stay with its base character")
+	}
+	if !strings.Contains(string(output), ">\U0001F1EF\U0001F1F5<") {
+		t.Error("Regional indicator pair should render as one flag")
+	}
+	if !regexp.MustCompile(`<text x="45.2"[^>]*>\|end<`).Match(output) {
+		t.Errorf("Text after clusters should be aligned to column 3:\n%s", output)
+	}
+}
+
+func TestTUITextAttributes(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	input := "\x1b[3mitalic\x1b[0m \x1b[2mdim\x1b[0m \x1b[4munder\x1b[0m \x1b[9mstrike\x1b[0m " +
+		"\x1b[7mreverse\x1b[0m \x1b[8msecret\x1b[0m \x1b[53mover\x1b[0m \x1b[5mblink\x1b[0m"
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	checks := []struct {
+		name    string
+		pattern string
+	}{
+		{"italic", `font-style="italic"[^>]*>italic<`},
+		{"dim", `opacity="0.5"[^>]*>dim<`},
+		{"reverse background", `<rect [^>]*fill="#abb2bf"/>\s*<text [^>]*fill="#282c34"[^>]*>reverse<`},
+		{"blink", `class="blink"[^>]*>blink<`},
+		{"decoration lines", `(?s)>under<.*<line .*>strike<.*<line .*>over<.*<line `},
+	}
+	for _, c := range checks {
+		if !regexp.MustCompile(c.pattern).Match(output) {
+			t.Errorf("%s not rendered as expected:\n%s", c.name, output)
+		}
+	}
+	if strings.Contains(string(output), "secret") {
+		t.Error("Invisible text should not be rendered")
+	}
+}
+
+func TestTUIUnderlineStyles(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Curly red underline (neovim diagnostic style), then dotted and dashed,
+	// plus a colon-form RGB foreground.
+	input := "\x1b[4:3;58:2::255:0:0merror\x1b[59;4:4m dotted\x1b[4:5m dashed\x1b[0m \x1b[38:2::0:128:255mrgb\x1b[0m"
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	checks := []struct {
+		name    string
+		pattern string
+	}{
+		{"curly underline", `>error</text>\s*<path d="M[^"]*t[^"]*" fill="none" stroke="#ff0000"`},
+		{"dotted underline", `> dotted</text>\s*<line [^>]*stroke="#abb2bf"[^>]*stroke-dasharray=`},
+		{"dashed underline", `> dashed</text>\s*<line [^>]*stroke-dasharray=`},
+		{"colon RGB color", `fill="#0080ff"[^>]*>rgb<`},
+	}
+	for _, c := range checks {
+		if !regexp.MustCompile(c.pattern).Match(output) {
+			t.Errorf("%s not rendered as expected:\n%s", c.name, output)
+		}
+	}
+}
+
+func TestTUIHyperlinks(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	input := "\x1b]8;;https://example.com/pr/1\x1b\\open_pr\x1b]8;;\x1b\\ " +
+		"\x1b]8;;javascript:alert(1)\x07unsafe\x1b]8;;\x07"
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader(input)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+
+	if !regexp.MustCompile(`<a href="https://example.com/pr/1"[^>]*>\s*<text [^>]*>open_pr</text>\s*</a>`).Match(output) {
+		t.Errorf("Hyperlinked text should be wrapped in <a>:\n%s", output)
+	}
+	if strings.Contains(string(output), "javascript:") {
+		t.Error("Unsafe URL schemes should not be linked")
+	}
+	if !strings.Contains(string(output), ">unsafe<") {
+		t.Error("Text of an unsafe link should still be rendered")
+	}
+
+	// Links reach the output percent-encoded, and links that are not
+	// UTF-8 are dropped, so the markup stays well-formed.
+	input = "\x1b]8;;https://example.com/a b\x1b\\spaced\x1b]8;;\x1b\\ " +
+		"\x1b]8;;http://a/\xff\x1b\\binary\x1b]8;;\x1b\\"
+	for _, format := range []string{"svg", "html"} {
+		t.Run(format, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-format", format, "-o", "-")
+			cmd.Stdin = strings.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), `href="https://example.com/a%20b"`) {
+				t.Errorf("Link should be percent-encoded:\n%s", output)
+			}
+			if strings.Contains(string(output), "\xff") || strings.Contains(string(output), `href="http://a/`) {
+				t.Errorf("Link that is not UTF-8 should be dropped:\n%s", output)
+			}
+			if !strings.Contains(string(output), "binary") {
+				t.Error("Text of a dropped link should still be rendered")
+			}
+		})
+	}
+
+	// A link too long to keep is dropped whole rather than cut short.
+	long := "https://example.com/" + strings.Repeat("x", 5000) + "?q=1"
+	cmd = exec.Command("./agentshot_test_bin", "tui", "-o", "-")
+	cmd.Stdin = strings.NewReader("\x1b]8;;" + long + "\x1b\\toolong\x1b]8;;\x1b\\ \x1b]8;;https://example.com/ok\x07fine\x1b]8;;\x07")
+	output, err = cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+	}
+	if strings.Contains(string(output), "xxxx") {
+		t.Error("An oversized link should not be linked")
+	}
+	if !strings.Contains(string(output), ">toolong<") || !strings.Contains(string(output), `href="https://example.com/ok"`) {
+		t.Errorf("Text after an oversized link should render normally:\n%s", output)
+	}
+}
+
+func TestTUIWindowChrome(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "macos with program title",
+			args:    []string{"-window", "macos", "printf '\\033]2;custom title\\007hello'"},
+			want:    []string{"<circle", ">custom title<", "agentshot-shadow", ">hello<"},
+			notWant: []string{">printf"},
+		},
+		{
+			name:    "invalid program title",
+			args:    []string{"-window", "macos", "printf '\\033]0;bad\\377\\376ti\\tt\\177le\\007hello'"},
+			want:    []string{">bad\uFFFDtitle<", ">hello<"},
+			notWant: []string{"\xff", "\x7f"},
+		},
+		{
+			name: "tab falls back to command",
+			args: []string{"-window", "tab", "echo tab_test"},
+			want: []string{">echo tab_test<", "rx="},
+		},
+		{
+			name:    "no chrome by default",
+			args:    []string{"echo plain"},
+			notWant: []string{"<circle", "agentshot-shadow"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q", s)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(output), s) {
+					t.Errorf("Output should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestTUICursor(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	tests := []struct {
+		name    string
+		args    []string
+		input   string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "block cursor inverts the cell",
+			args:  []string{"-cursor", "block"},
+			input: "> ab\x1b[D",
+			want:  []string{`<rect x="45.2" y="20.0" width="8.4" height="16.8" fill="#528bff"/>`, `fill="#282c34" font-weight="normal" xml:space="preserve">b<`},
+		},
+		{
+			name:  "auto uses the program's shape",
+			args:  []string{"-cursor", "auto"},
+			input: "> ab\x1b[5 q",
+			want:  []string{`<rect x="53.6" y="20.0" width="2.0" height="16.8"`},
+		},
+		{
+			name:    "hidden with DECTCEM",
+			args:    []string{"-cursor", "block"},
+			input:   "> ab\x1b[?25l",
+			notWant: []string{`<rect x=`},
+		},
+		{
+			name:    "not drawn by default",
+			input:   "> ab",
+			notWant: []string{`<rect x=`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-cols", "10", "-rows", "2"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader(tt.input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q\nOutput: %s", s, output)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(output), s) {
+					t.Errorf("Output should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestTUIThemes(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"scheme.itermcolors": `<?xml version="1.0" encoding="UTF-8"?>
+<plist version="1.0">
+<dict>
+	<key>Ansi 1 Color</key>
+	<dict>
+		<key>Blue Component</key><real>0.0</real>
+		<key>Green Component</key><real>0.0</real>
+		<key>Red Component</key><real>1</real>
+	</dict>
+	<key>Background Color</key>
+	<dict>
+		<key>Blue Component</key><real>0.2</real>
+		<key>Green Component</key><real>0.2</real>
+		<key>Red Component</key><real>0.2</real>
+	</dict>
+	<key>Foreground Color</key>
+	<dict>
+		<key>Blue Component</key><real>1</real>
+		<key>Green Component</key><real>1</real>
+		<key>Red Component</key><real>1</real>
+	</dict>
+` + itermAnsi(0, 2, 3, 4, 5, 6, 7) + `</dict>
+</plist>
+`,
+		"alacritty.toml": `[colors.primary]
+background = "#101010"
+foreground = "0xeeeeee"
+
+[colors.normal]
+black = "#000000"
+red = "#ff0001"
+green = "#00ff00"
+yellow = "#ffff00"
+blue = "#0000ff"
+magenta = "#ff00ff"
+cyan = "#00ffff"
+white = "#ffffff"
+`,
+		"alacritty.yml": `colors:
+  primary:
+    background: '#101010'
+    foreground: '#eeeeee'
+  normal:
+    black: '#000000'
+    red: '#ff0002'
+    green: '#00ff00'
+    yellow: '#ffff00'
+    blue: '#0000ff'
+    magenta: '#ff00ff'
+    cyan: '#00ffff'
+    white: '#ffffff'
+`,
+		"terminal.json": `{"schemes": [{"name": "Team", "background": "#101010", "foreground": "#EEEEEE",
+"black": "#000000", "red": "#FF0003", "green": "#00FF00", "yellow": "#FFFF00",
+"blue": "#0000FF", "purple": "#FF00FF", "cyan": "#00FFFF", "white": "#FFFFFF"}]}`,
+		"base16.yaml": `scheme: "Team"
+base00: "101010"
+base01: "202020"
+base02: "303030"
+base03: "404040"
+base04: "505050"
+base05: "eeeeee"
+base06: "f0f0f0"
+base07: "ffffff"
+base08: "ff0004"
+base09: "ff8800"
+base0A: "ffff00"
+base0B: "00ff00"
+base0C: "00ffff"
+base0D: "0000ff"
+base0E: "ff00ff"
+base0F: "884400"
+`,
+		"bad.json": `{"background": "#101010", "foreground": "red\" onload=\"x", "black": "#000000"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		theme   string
+		want    []string
+		wantErr bool
+	}{
+		{theme: "solarized-light", want: []string{`fill="#fdf6e3"`, `fill="#dc322f"`}},
+		{theme: filepath.Join(dir, "scheme.itermcolors"), want: []string{`fill="#333333"`, `fill="#ff0000"`}},
+		{theme: filepath.Join(dir, "alacritty.toml"), want: []string{`fill="#101010"`, `fill="#ff0001"`}},
+		{theme: filepath.Join(dir, "alacritty.yml"), want: []string{`fill="#101010"`, `fill="#ff0002"`}},
+		{theme: filepath.Join(dir, "terminal.json"), want: []string{`fill="#101010"`, `fill="#ff0003"`}},
+		{theme: filepath.Join(dir, "base16.yaml"), want: []string{`fill="#101010"`, `fill="#ff0004"`}},
+		{theme: filepath.Join(dir, "bad.json"), wantErr: true},
+		{theme: "no-such-theme", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(filepath.Base(tt.theme), func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "10", "-rows", "2", "-theme", tt.theme)
+			cmd.Stdin = strings.NewReader("\x1b[31mred\x1b[0m")
+			output, err := cmd.CombinedOutput()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got: %s", output)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q\nOutput: %s", s, output)
+				}
+			}
+		})
+	}
+}
+
+// itermAnsi returns .itermcolors entries for the given ANSI colors, all gray.
+func itermAnsi(indexes ...int) string {
+	var b strings.Builder
+	for _, i := range indexes {
+		fmt.Fprintf(&b, `	<key>Ansi %d Color</key>
+	<dict>
+		<key>Blue Component</key><real>0.5</real>
+		<key>Green Component</key><real>0.5</real>
+		<key>Red Component</key><real>0.5</real>
+	</dict>
+`, i)
+	}
+	return b.String()
+}
+
+func TestTUIPaletteChanges(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	tests := []struct {
+		name    string
+		input   string
+		command string
+		want    []string
+		notWant []string
+	}{
+		{
+			name:  "set palette and default colors",
+			input: "\x1b]4;1;rgb:12/34/56\x1b\\\x1b[31mred\x1b[0m\x1b]11;#ffffff\x07\x1b]10;rgb:0/0/0\x07 plain",
+			want:  []string{`fill="#123456"`, `<rect width="100%" height="100%" fill="#ffffff"/>`, `fill="#000000" font-weight="normal" xml:space="preserve">plain<`},
+		},
+		{
+			name:    "reset palette",
+			input:   "\x1b]4;2;#ff0000\x07\x1b]11;#ffffff\x07\x1b[32mgreen\x1b]104\x07\x1b]111\x07",
+			want:    []string{`fill="#98c379"`, `fill="#282c34"`},
+			notWant: []string{`fill="#ff0000"`, `fill="#ffffff"`},
+		},
+		{
+			name:    "answer background query",
+			command: `stty -echo; printf '\033]11;?\033\\'; IFS= read -r -d '\' -t 2 r; printf 'got %s\n' "$r" | cat -v`,
+			want:    []string{"got ^[]11;rgb:2828/2c2c/3434^["},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"tui", "-o", "-", "-cols", "60", "-rows", "3"}
+			if tt.command != "" {
+				args = append(args, tt.command)
+			}
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			if tt.input != "" {
+				cmd.Stdin = strings.NewReader(tt.input)
+			}
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q\nOutput: %s", s, output)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(string(output), s) {
+					t.Errorf("Output should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestTUITerminalQueries(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Each query is answered before read times out, so the program
+	// finishes quickly and prints the replies it got.
+	tests := []struct {
+		name  string
+		query string
+		until string
+		want  string
+	}{
+		{name: "cursor position", query: `\033[3;5H\033[6n`, until: "R", want: "got ^[[3;5"},
+		{name: "primary device attributes", query: `\033[c`, until: "c", want: "got ^[[?62;22"},
+		{name: "secondary device attributes", query: `\033[>c`, until: "c", want: "got ^[[&gt;1;10;0"},
+		{name: "version", query: `\033[>q`, until: `\`, want: "got ^[P&gt;|agentshot^["},
+		{name: "private mode", query: `\033[?25l\033[?25$p`, until: "y", want: "got ^[[?25;2$"},
+		{name: "cursor keys mode", query: `\033[?1h\033[?1$p`, until: "y", want: "got ^[[?1;1$"},
+		{name: "synchronized output mode", query: `\033[?2026$p`, until: "y", want: "got ^[[?2026;2$"},
+		{name: "unknown mode", query: `\033[?9999$p`, until: "y", want: "got ^[[?9999;0$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script := fmt.Sprintf(`stty -echo; printf '%s'; IFS= read -r -d '%s' -t 5 r; printf '\ngot %%s\n' "$r" | cat -v`, tt.query, tt.until)
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "60", "-rows", "6", "-delay", "0", script)
+			start := time.Now()
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output should contain %q\nOutput: %s", tt.want, output)
+			}
+			if elapsed := time.Since(start); elapsed > 4*time.Second {
+				t.Errorf("Query was not answered, took %v", elapsed)
+			}
+		})
+	}
+
+	t.Run("unread replies", func(t *testing.T) {
+		// A program that asks more than it reads must not hold up the
+		// capture once the timeout is up.
+		script := `stty raw -echo; for i in $(seq 1 5000); do printf '\033[6n'; done; echo flooded; sleep 60`
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-delay", "0", "-timeout", "2s", script)
+		start := time.Now()
+		done := make(chan []byte, 1)
+		go func() {
+			output, _ := cmd.CombinedOutput()
+			done <- output
+		}()
+		select {
+		case output := <-done:
+			if !strings.Contains(string(output), "flooded") {
+				t.Errorf("Output should contain %q\nOutput: %s", "flooded", output)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Capture took %v, want about the 2s timeout", elapsed)
+			}
+		case <-time.After(15 * time.Second):
+			cmd.Process.Kill()
+			t.Fatal("Capture hung on replies the program did not read")
+		}
+	})
+}
+
+func TestTUIPNGOutput(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	outPath := filepath.Join(t.TempDir(), "capture.png")
+	tests := []struct {
+		name       string
+		args       []string
+		fromStdout bool
+		width      int
+		height     int
+	}{
+		// 10 columns of 8.4 units plus 20 units of padding on each side,
+		// at two pixels per unit.
+		{name: "png extension", args: []string{"-o", outPath}, width: 248, height: 147},
+		{name: "format flag", args: []string{"-o", "-", "-format", "png"}, fromStdout: true, width: 248, height: 147},
+		{name: "window chrome", args: []string{"-o", "-", "-format", "png", "-window", "macos"}, fromStdout: true, width: 376, height: 342},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-cols", "10", "-rows", "2"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader("\x1b[1;41mhi\x1b[0m")
+			output, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("Command failed: %v", err)
+			}
+
+			data := output
+			if !tt.fromStdout {
+				if data, err = os.ReadFile(outPath); err != nil {
+					t.Fatalf("Failed to read output: %v", err)
+				}
+			}
+			img, err := png.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatalf("Output is not a PNG: %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.width || b.Dy() != tt.height {
+				t.Errorf("Size = %dx%d, want %dx%d", b.Dx(), b.Dy(), tt.width, tt.height)
+			}
+			if tt.args[len(tt.args)-1] == "png" {
+				// The red background of the first cell.
+				r, g, b, _ := img.At(42, 42).RGBA()
+				if r>>8 != 0xe0 || g>>8 != 0x6c || b>>8 != 0x75 {
+					t.Errorf("Cell background = #%02x%02x%02x, want #e06c75", r>>8, g>>8, b>>8)
+				}
+			}
+		})
+	}
+
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-format", "bmp", "-o", "-")
+	cmd.Stdin = strings.NewReader("hi")
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("Expected an error for an unknown format, got: %s", output)
+	}
+}
+
+func TestTUIEmbedFont(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	dir := t.TempDir()
+	fontPath := filepath.Join(dir, "mono.ttf")
+	if err := os.WriteFile(fontPath, gomono.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	badPath := filepath.Join(dir, "bad.ttf")
+	if err := os.WriteFile(badPath, []byte("not a font"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fontFace := regexp.MustCompile(`font-weight:(\w+);font-style:\w+;src:url\(data:font/ttf;base64,([^)]+)\)`)
+	tests := []struct {
+		name    string
+		font    string
+		weights []string
+	}{
+		{name: "bundled", font: "go-mono", weights: []string{"normal", "bold"}},
+		{name: "file", font: fontPath, weights: []string{"normal"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "2", "-embed-font", tt.font)
+			cmd.Stdin = strings.NewReader("hello \x1b[1mbold\x1b[0m")
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), `font-family="agentshot-embedded, monospace"`) {
+				t.Errorf("Text should use the embedded font\nOutput: %s", output)
+			}
+
+			faces := fontFace.FindAllStringSubmatch(string(output), -1)
+			if len(faces) != len(tt.weights) {
+				t.Fatalf("Got %d @font-face rules, want %d", len(faces), len(tt.weights))
+			}
+			for i, face := range faces {
+				if face[1] != tt.weights[i] {
+					t.Errorf("Face %d has weight %s, want %s", i, face[1], tt.weights[i])
+				}
+				data, err := base64.StdEncoding.DecodeString(face[2])
+				if err != nil {
+					t.Fatalf("Invalid base64: %v", err)
+				}
+				if len(data) >= len(gomono.TTF)/2 {
+					t.Errorf("Font is %d bytes, not subset", len(data))
+				}
+				f, err := sfnt.Parse(data)
+				if err != nil {
+					t.Fatalf("Embedded font does not parse: %v", err)
+				}
+				// Glyphs in use keep their outlines; others are emptied.
+				var buf sfnt.Buffer
+				for r, want := range map[rune]bool{'o': true, 'z': false} {
+					gid, err := f.GlyphIndex(&buf, r)
+					if err != nil {
+						t.Fatal(err)
+					}
+					segs, err := f.LoadGlyph(&buf, gid, fixed.I(14), nil)
+					if err != nil {
+						t.Fatalf("Failed to load %q: %v", r, err)
+					}
+					if (len(segs) > 0) != want {
+						t.Errorf("Glyph %q has %d segments, want outline: %v", r, len(segs), want)
+					}
+				}
+			}
+		})
+	}
+
+	cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-embed-font", badPath)
+	cmd.Stdin = strings.NewReader("hi")
+	if output, err := cmd.CombinedOutput(); err == nil {
+		t.Errorf("Expected an error for an invalid font, got: %s", output)
+	}
+}
+
+func TestTUITextFormats(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	input := "plain \x1b[1;31mred\x1b[0m   \r\n\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\ <b>\r\n\r\n"
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{format: "txt", want: []string{"plain red\nlink <b>\n"}},
+		{format: "ansi", want: []string{"plain \x1b[0;1;31mred\x1b[0m\n\x1b]8;;https://example.com\x1b\\link\x1b]8;;\x1b\\ <b>\n"}},
+		{format: "html", want: []string{
+			"<!DOCTYPE html>",
+			`<pre>plain <span style="color:#e06c75;font-weight:bold">red</span>`,
+			`<a href="https://example.com">link</a> &lt;b&gt;`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "4", "-format", tt.format)
+			cmd.Stdin = strings.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q\nOutput: %q", s, output)
+				}
+			}
+		})
+	}
+
+	t.Run("json", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "4", "-format", "json")
+		cmd.Stdin = strings.NewReader(input + "中")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+
+		var grid struct {
+			Cols   int `json:"cols"`
+			Rows   int `json:"rows"`
+			Cursor struct {
+				X, Y    int
+				Visible bool
+			} `json:"cursor"`
+			Cells [][]struct {
+				Ch    string `json:"ch"`
+				Width int    `json:"width"`
+				Fg    string `json:"fg"`
+				Bold  bool   `json:"bold"`
+			} `json:"cells"`
+			Lines []struct {
+				Text  string `json:"text"`
+				Spans []struct {
+					Col   int    `json:"col"`
+					Width int    `json:"width"`
+					Text  string `json:"text"`
+					Fg    string `json:"fg"`
+					Bold  bool   `json:"bold"`
+					Link  string `json:"link"`
+				} `json:"spans"`
+			} `json:"lines"`
+		}
+		if err := json.Unmarshal(output, &grid); err != nil {
+			t.Fatalf("Invalid JSON: %v\nOutput: %s", err, output)
+		}
+		if grid.Cols != 20 || grid.Rows != 4 || len(grid.Lines) != 4 {
+			t.Fatalf("Got %dx%d with %d lines", grid.Cols, grid.Rows, len(grid.Lines))
+		}
+		if grid.Cursor.X != 2 || grid.Cursor.Y != 3 || !grid.Cursor.Visible {
+			t.Errorf("Cursor = %+v, want visible at 2,3", grid.Cursor)
+		}
+		if len(grid.Cells) != 4 || len(grid.Cells[0]) != 20 {
+			t.Fatalf("Cells should cover the grid, got %d rows", len(grid.Cells))
+		}
+		if c := grid.Cells[0][6]; c.Ch != "r" || c.Width != 1 || c.Fg != "#e06c75" || !c.Bold {
+			t.Errorf("Cell 6,0 = %+v", c)
+		}
+		if c := grid.Cells[0][0]; c.Ch != "p" || c.Fg != "" || c.Bold {
+			t.Errorf("Cell 0,0 = %+v", c)
+		}
+		if lead, cont := grid.Cells[3][0], grid.Cells[3][1]; lead.Ch != "中" || lead.Width != 2 || cont.Ch != "" || cont.Width != 0 {
+			t.Errorf("Wide cells = %+v, %+v", lead, cont)
+		}
+		if grid.Lines[1].Text != "link <b>" {
+			t.Errorf("Line 1 = %q", grid.Lines[1].Text)
+		}
+		red := grid.Lines[0].Spans
+		if len(red) != 1 || red[0].Col != 6 || red[0].Width != 3 || red[0].Text != "red" || red[0].Fg != "#e06c75" || !red[0].Bold {
+			t.Errorf("Line 0 spans = %+v", red)
+		}
+		if link := grid.Lines[1].Spans; len(link) != 1 || link[0].Link != "https://example.com" {
+			t.Errorf("Line 1 spans = %+v", link)
+		}
+	})
+
+	t.Run("json without cursor", func(t *testing.T) {
+		// A hidden cursor, or one cropped away by -fit, has no position.
+		for _, tt := range []struct {
+			args  []string
+			input string
+		}{
+			{input: "   x\r\n\x1b[?25l"},
+			{args: []string{"-fit", "box"}, input: "   x\r\n"},
+		} {
+			args := append([]string{"tui", "-o", "-", "-format", "json"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader(tt.input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			var grid struct {
+				Cursor map[string]any `json:"cursor"`
+			}
+			if err := json.Unmarshal(output, &grid); err != nil {
+				t.Fatalf("Invalid JSON: %v\nOutput: %s", err, output)
+			}
+			if _, ok := grid.Cursor["x"]; ok || grid.Cursor["visible"] != false {
+				t.Errorf("%q: cursor = %v, want no position", tt.input, grid.Cursor)
+			}
+		}
+	})
+
+	// Concealed text is blank on screen, so the text formats leave it out.
+	for _, format := range []string{"txt", "ansi", "json", "html"} {
+		t.Run("concealed "+format, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "2", "-format", format)
+			cmd.Stdin = strings.NewReader("pw: \x1b[8msecret\x1b[0m ok")
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if strings.Contains(string(output), "secret") {
+				t.Errorf("Concealed text should not be in the output:\n%s", output)
+			}
+			if !strings.Contains(string(output), " ok") {
+				t.Errorf("Text after concealed text should be in the output:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestTUIScrollback(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	var input strings.Builder
+	for i := 1; i <= 12; i++ {
+		fmt.Fprintf(&input, "line %d\r\n", i)
+	}
+	input.WriteString("$ ")
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name: "screen only",
+			args: []string{},
+			want: "line 10\nline 11\nline 12\n$\n",
+		},
+		{
+			name: "history",
+			args: []string{"-history"},
+			want: "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\nline 11\nline 12\n$\n",
+		},
+		{
+			name: "last lines",
+			args: []string{"-lines", "6"},
+			want: "line 8\nline 9\nline 10\nline 11\nline 12\n$\n",
+		},
+		{
+			name: "limited scrollback",
+			args: []string{"-history", "-scrollback", "2"},
+			want: "line 8\nline 9\nline 10\nline 11\nline 12\n$\n",
+		},
+		{
+			name:  "erased scrollback",
+			args:  []string{"-history"},
+			input: strings.Replace(input.String(), "line 10", "\x1b[3Jline 10", 1),
+			want:  "line 7\nline 8\nline 9\nline 10\nline 11\nline 12\n$\n",
+		},
+		{
+			name:  "deleted lines",
+			args:  []string{"-history"},
+			input: input.String() + "\x1b[1;1H\x1b[2M",
+			want:  "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 12\n$\n",
+		},
+		{
+			name:  "scrolled up",
+			args:  []string{"-history"},
+			input: input.String() + "\x1b[2S",
+			want:  "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\nline 10\nline 11\nline 12\n$\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "txt", "-cols", "20", "-rows", "4"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader(cmp.Or(tt.input, input.String()))
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("tall svg", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "20", "-rows", "4", "-history")
+		cmd.Stdin = strings.NewReader(input.String())
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		for _, s := range []string{">line 1<", ">line 12<"} {
+			if !strings.Contains(string(output), s) {
+				t.Errorf("SVG should contain %q", s)
+			}
+		}
+	})
+}
+
+func TestTUIFit(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	input := "\r\n   hello\r\n  \x1b[41m  \x1b[0m wide 世\r\n"
+	tests := []struct {
+		name  string
+		args  []string
+		cols  int
+		rows  int
+		lines []string
+	}{
+		{name: "none", args: []string{}, cols: 40, rows: 10, lines: []string{"", "   hello", "     wide 世", "", "", "", "", "", "", ""}},
+		{name: "trim", args: []string{"-fit", "trim"}, cols: 12, rows: 3, lines: []string{"", "   hello", "     wide 世"}},
+		{name: "box", args: []string{"-fit", "box"}, cols: 10, rows: 2, lines: []string{" hello", "   wide 世"}},
+		{name: "box with cursor", args: []string{"-fit", "box", "-cursor", "block"}, cols: 12, rows: 3, lines: []string{"   hello", "     wide 世", ""}},
+		{name: "minimum size", args: []string{"-fit", "box", "-min-cols", "20", "-min-rows", "4"}, cols: 20, rows: 4, lines: []string{" hello", "   wide 世", "", ""}},
+		{name: "minimum beyond grid", args: []string{"-fit", "trim", "-min-cols", "100", "-min-rows", "100"}, cols: 40, rows: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "json", "-cols", "40", "-rows", "10"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader(input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+
+			var grid struct {
+				Cols  int `json:"cols"`
+				Rows  int `json:"rows"`
+				Lines []struct {
+					Text string `json:"text"`
+				} `json:"lines"`
+			}
+			if err := json.Unmarshal(output, &grid); err != nil {
+				t.Fatalf("Invalid JSON: %v\nOutput: %s", err, output)
+			}
+			if grid.Cols != tt.cols || grid.Rows != tt.rows || len(grid.Lines) != tt.rows {
+				t.Errorf("Size = %dx%d with %d lines, want %dx%d", grid.Cols, grid.Rows, len(grid.Lines), tt.cols, tt.rows)
+			}
+			if tt.lines == nil {
+				return
+			}
+			var lines []string
+			for _, l := range grid.Lines {
+				lines = append(lines, l.Text)
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.lines, "\n") {
+				t.Errorf("Lines = %q, want %q", lines, tt.lines)
+			}
+		})
+	}
+
+	t.Run("svg size", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "40", "-rows", "10", "-fit", "box")
+		cmd.Stdin = strings.NewReader(input)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		full := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-cols", "40", "-rows", "10")
+		full.Stdin = strings.NewReader(input)
+		fullOutput, err := full.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, fullOutput)
+		}
+		width := regexp.MustCompile(`<svg[^>]* width="([0-9.]+)"`)
+		fit, all := width.FindSubmatch(output), width.FindSubmatch(fullOutput)
+		if fit == nil || all == nil || len(fit[1]) == 0 || string(fit[1]) == string(all[1]) {
+			t.Errorf("Fitted SVG width = %q, full width = %q", fit, all)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-fit", "tight")
+		cmd.Stdin = strings.NewReader(input)
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("Expected failure, got: %s", output)
+		}
+		if !strings.Contains(string(output), `invalid fit "tight"`) {
+			t.Errorf("Output should name the invalid mode\nOutput: %s", output)
+		}
+	})
+}
+
+func TestTUIKeys(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// readKeys prints the next n bytes typed, in raw mode, quoted by bash.
+	readKeys := func(setup string, n int) string {
+		return fmt.Sprintf(`%sstty raw -echo; echo ready; k=$(head -c %d); printf '%%q\r\n' "$k"`, setup, n)
+	}
+	tests := []struct {
+		name    string
+		keys    string
+		command string
+		want    string
+	}{
+		{
+			name:    "text and enter",
+			keys:    `wait /ready/ "hello world" Enter`,
+			command: `echo ready; read x; echo "got $x"`,
+			want:    "got hello world",
+		},
+		{
+			name:    "single characters",
+			keys:    `wait /ready/ j j k Enter`,
+			command: `echo ready; read x; echo "got $x"`,
+			want:    "got jjk",
+		},
+		{
+			name:    "named keys",
+			keys:    `wait /ready/ Tab Esc Backspace F1 F5 F12 PageDown`,
+			command: readKeys("", 20),
+			want:    `$'\t\E\177\EOP\E[15~\E[24~\E[6~'`,
+		},
+		{
+			name:    "modifiers",
+			keys:    `wait /ready/ ctrl-a ctrl-x alt-b alt-Up`,
+			command: readKeys("", 8),
+			want:    `$'\001\030\Eb\E\E[A'`,
+		},
+		{
+			name:    "cursor keys",
+			keys:    `wait /ready/ Up Left Home`,
+			command: readKeys("", 9),
+			want:    `$'\E[A\E[D\E[H'`,
+		},
+		{
+			name:    "application cursor keys",
+			keys:    `wait /ready/ Up Left Home`,
+			command: readKeys(`printf '\e[?1h'; `, 9),
+			want:    `$'\EOA\EOD\EOH'`,
+		},
+		{
+			name:    "sleep and comments",
+			keys:    "sleep 200ms # let the prompt appear\n\"a\\tb\" Enter",
+			command: `read -r x; printf 'got %q\n' "$x"`,
+			want:    `got $'a\tb'`,
+		},
+		{
+			name:    "slash in wait",
+			keys:    `wait /a\/b/ "ok" Enter`,
+			command: `echo a/b; read x; echo "got $x"`,
+			want:    "got ok",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "60", "-rows", "6", "-delay", "200ms", "-keys", tt.keys, tt.command)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output should contain %q\nOutput: %s", tt.want, output)
+			}
+		})
+	}
+
+	t.Run("script file", func(t *testing.T) {
+		script := filepath.Join(t.TempDir(), "menu.keys")
+		if err := os.WriteFile(script, []byte("# pick the second item\nwait /ready/\nDown\nEnter\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "60", "-rows", "6", "-delay", "200ms", "-script", script,
+			`echo ready; read x; printf 'got %q\n' "$x"`)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		if want := `got $'\E[B'`; !strings.Contains(string(output), want) {
+			t.Errorf("Output should contain %q\nOutput: %s", want, output)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "unknown key", args: []string{"-keys", "Entr"}, want: `unknown key "Entr"`},
+		{name: "unterminated string", args: []string{"-keys", `"abc`}, want: "unterminated string"},
+		{name: "bad sleep", args: []string{"-keys", "sleep soon"}, want: `sleep: invalid duration "soon"`},
+		{name: "wait without regex", args: []string{"-keys", "wait ready"}, want: "wait: want /regex/"},
+		{name: "both flags", args: []string{"-keys", "a", "-script", "x.keys"}, want: "cannot be used together"},
+		{name: "wait timed out", args: []string{"-keys", "wait /never/"}, want: "command exited while waiting for /never/"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-delay", "0"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, "echo hi")...)
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("Expected failure, got: %s", output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output should contain %q\nOutput: %s", tt.want, output)
+			}
+		})
+	}
+
+	t.Run("piped input", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-keys", "Enter")
+		cmd.Stdin = strings.NewReader("hello")
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("Expected failure, got: %s", output)
+		}
+		if !strings.Contains(string(output), "need a command") {
+			t.Errorf("Output should explain that keys need a command\nOutput: %s", output)
+		}
+	})
+}
+
+func TestTUIWait(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// The commands keep running long after the screen is ready, so a
+	// capture that waited for them would be slow.
+	tests := []struct {
+		name    string
+		args    []string
+		command string
+		want    string
+		notWant string
+	}{
+		{
+			name:    "wait for",
+			args:    []string{"-wait-for", "build (ok|failed)"},
+			command: "echo building; sleep 0.3; echo build ok; sleep 30",
+			want:    "building\nbuild ok\n",
+		},
+		{
+			name:    "wait gone",
+			args:    []string{"-wait-gone", "Loading"},
+			command: `sleep 0.2; echo Loading; sleep 0.3; printf '\033[2J\033[HReady'; sleep 30`,
+			want:    "Ready\n",
+			notWant: "Loading",
+		},
+		{
+			name:    "wait for both",
+			args:    []string{"-wait-for", "Ready", "-wait-gone", "Loading"},
+			command: `echo Ready Loading; sleep 0.3; printf '\033[2J\033[HReady'; sleep 30`,
+			want:    "Ready\n",
+			notWant: "Loading",
+		},
+		{
+			name:    "command exits",
+			args:    []string{"-wait-for", "done"},
+			command: "echo done",
+			want:    "done\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "txt", "-cols", "40", "-rows", "4"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, tt.command)...)
+			start := time.Now()
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Output = %q, want %q", output, tt.want)
+			}
+			if tt.notWant != "" && strings.Contains(string(output), tt.notWant) {
+				t.Errorf("Output should not contain %q\nOutput: %s", tt.notWant, output)
+			}
+			if elapsed := time.Since(start); elapsed > 3*time.Second {
+				t.Errorf("Capture was not taken when ready, took %v", elapsed)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		command string
+		want    []string
+	}{
+		{
+			name:    "timeout",
+			args:    []string{"-timeout", "300ms", "-wait-for", "never"},
+			command: "echo partial; sleep 30",
+			want:    []string{"partial\n", "timed out after 300ms waiting for /never/ (captured the screen as it was)"},
+		},
+		{
+			name:    "timeout waiting for text to go",
+			args:    []string{"-timeout", "300ms", "-wait-gone", "spinner"},
+			command: "echo spinner; sleep 30",
+			want:    []string{"spinner\n", "timed out after 300ms waiting for /spinner/ to disappear"},
+		},
+		{
+			name:    "exited first",
+			args:    []string{"-wait-for", "never"},
+			command: "echo partial",
+			want:    []string{"partial\n", "command exited while waiting for /never/"},
+		},
+		{
+			name:    "invalid regex",
+			args:    []string{"-wait-for", "("},
+			command: "echo hi",
+			want:    []string{"Invalid -wait-for"},
+		},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "txt", "-cols", "40", "-rows", "4"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, tt.command)...)
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("Expected failure, got: %s", output)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(string(output), s) {
+					t.Errorf("Output should contain %q\nOutput: %s", s, output)
+				}
+			}
+		})
+	}
+
+	t.Run("partial capture file", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "partial.txt")
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", outPath, "-cols", "40", "-rows", "4", "-timeout", "300ms", "-wait-for", "never", "echo partial; sleep 30")
+		if output, err := cmd.CombinedOutput(); err == nil {
+			t.Fatalf("Expected failure, got: %s", output)
+		}
+		data, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("Partial capture was not written: %v", err)
+		}
+		if string(data) != "partial\n" {
+			t.Errorf("Partial capture = %q", data)
+		}
+	})
+}
+
+func TestTUISettle(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	t.Run("quiet screen", func(t *testing.T) {
+		// Output arrives faster than the settle window, then stops while
+		// the program keeps running.
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "40", "-rows", "4", "-settle", "300ms",
+			"for i in 1 2 3 4 5; do echo $i; sleep 0.1; done; sleep 30")
+		start := time.Now()
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		if want := "3\n4\n5\n"; string(output) != want {
+			t.Errorf("Output = %q, want %q", output, want)
+		}
+		if elapsed := time.Since(start); elapsed < 600*time.Millisecond || elapsed > 3*time.Second {
+			t.Errorf("Capture should follow the last output by the settle time, took %v", elapsed)
+		}
+	})
+
+	t.Run("after wait", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "40", "-rows", "4", "-wait-for", "start", "-settle", "300ms",
+			"echo start; sleep 0.1; echo more; sleep 30")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		if want := "start\nmore\n"; string(output) != want {
+			t.Errorf("Output = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("never quiet", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "40", "-rows", "4", "-settle", "300ms", "-timeout", "1s",
+			"while :; do echo tick; sleep 0.1; done")
+		output, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Fatalf("Expected failure, got: %s", output)
+		}
+		for _, s := range []string{"tick", "timed out after 1s waiting for 300ms without output"} {
+			if !strings.Contains(string(output), s) {
+				t.Errorf("Output should contain %q\nOutput: %s", s, output)
+			}
+		}
+	})
+}
+
+func TestTUISynchronizedOutput(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	tests := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "finished update",
+			input: "old\x1b[?2026h\x1b[2J\x1b[Hnew\x1b[?2026l",
+			want:  "new\n",
+		},
+		{
+			name:  "update in progress",
+			input: "old frame\r\n\x1b[?2026h\x1b[2J\x1b[Hhalf",
+			want:  "old frame\n",
+		},
+		{
+			name:  "nested begin",
+			input: "one\x1b[?2026h\x1b[Htwo\x1b[?2026h\x1b[Hsix",
+			want:  "one\n",
+		},
+		{
+			name:  "reset ends the update",
+			input: "old\x1b[?2026h\x1bcnew",
+			want:  "new\n",
+		},
+		{
+			name:  "scrollback during update",
+			args:  []string{"-history", "-scrollback", "2"},
+			input: "1\r\n2\r\n3\r\n4\x1b[?2026h\r\n5\r\n6\r\n7",
+			want:  "1\n2\n3\n4\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-format", "txt", "-cols", "20", "-rows", "2"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", args...)
+			cmd.Stdin = strings.NewReader(tt.input)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if string(output) != tt.want {
+				t.Errorf("Output = %q, want %q", output, tt.want)
+			}
+		})
+	}
+
+	t.Run("wait for a whole frame", func(t *testing.T) {
+		// The marker is drawn early in the frame; the capture has to wait
+		// for the rest of it.
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "20", "-rows", "2", "-wait-for", "half",
+			`printf 'old\033[?2026h\033[2J\033[Hhalf'; sleep 0.3; printf ' done\033[?2026l'; sleep 30`)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		if want := "half done\n"; string(output) != want {
+			t.Errorf("Output = %q, want %q", output, want)
+		}
+	})
+
+	t.Run("abandoned update", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "txt", "-cols", "20", "-rows", "2", "-wait-for", "half",
+			`printf 'old\033[?2026h\033[2J\033[Hhalf'; sleep 30`)
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		if want := "half\n"; string(output) != want {
+			t.Errorf("Output = %q, want %q", output, want)
+		}
+	})
+}
+
+func TestTUIFrames(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	// Prints a line every 200ms, so frames 600ms apart show different
+	// lines.
+	counter := "for i in $(seq 1 50); do echo line $i; sleep 0.2; done"
+	tests := []struct {
+		name    string
+		out     string
+		args    []string
+		command string
+		files   []string
+		within  time.Duration // default 5s
+	}{
+		{
+			name:    "every",
+			out:     "out.txt",
+			args:    []string{"-every", "600ms", "-count", "3"},
+			command: counter,
+			files:   []string{"out-1.txt", "out-2.txt", "out-3.txt"},
+		},
+		{
+			name:    "list",
+			out:     "out.txt",
+			args:    []string{"-frames", "1.2s,300ms"},
+			command: counter,
+			files:   []string{"out-1.txt", "out-2.txt"},
+		},
+		{
+			name:    "padded numbers",
+			out:     "out.txt",
+			args:    []string{"-every", "10ms", "-count", "10"},
+			command: "echo same",
+			files:   []string{"out-01.txt", "out-05.txt", "out-10.txt"},
+		},
+		{
+			name:    "printf pattern",
+			out:     "frame-%03d.json",
+			args:    []string{"-frames", "100ms,200ms"},
+			command: "echo same",
+			files:   []string{"frame-001.json", "frame-002.json"},
+		},
+		{
+			name:    "literal percent",
+			out:     "50%.txt",
+			args:    []string{"-frames", "100ms,200ms"},
+			command: "echo same",
+			files:   []string{"50%-1.txt", "50%-2.txt"},
+		},
+		{
+			name:    "escaped percent",
+			out:     "a%%.txt",
+			args:    []string{"-frames", "100ms,200ms"},
+			command: "echo same",
+			files:   []string{"a%%-1.txt", "a%%-2.txt"},
+		},
+		{
+			name:    "two verbs",
+			out:     "f%d-%d.txt",
+			args:    []string{"-frames", "100ms,200ms"},
+			command: "echo same",
+			files:   []string{"f%d-%d-1.txt", "f%d-%d-2.txt"},
+		},
+		{
+			name:    "after exit",
+			out:     "out.txt",
+			args:    []string{"-frames", "100ms,4s"},
+			command: "echo same",
+			files:   []string{"out-1.txt", "out-2.txt"},
+			within:  2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			args := append([]string{"tui", "-o", filepath.Join(dir, tt.out), "-cols", "20", "-rows", "2"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, tt.command)...)
+			start := time.Now()
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			if elapsed := time.Since(start); elapsed > cmp.Or(tt.within, 5*time.Second) {
+				t.Errorf("Frames should not wait for the command, took %v", elapsed)
+			}
+			for _, name := range tt.files {
+				path := filepath.Join(dir, name)
+				if !strings.Contains(string(output), path+"\n") {
+					t.Errorf("Output should list %s\nOutput: %s", path, output)
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("Frame not written: %v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("frames show progress", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", filepath.Join(dir, "out.txt"), "-cols", "20", "-rows", "2", "-frames", "300ms,1.5s", counter)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		first, err := os.ReadFile(filepath.Join(dir, "out-1.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := os.ReadFile(filepath.Join(dir, "out-2.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(first), "line 2") || !strings.Contains(string(second), "line 8") {
+			t.Errorf("Frames = %q and %q, want lines 2 and 8", first, second)
+		}
+	})
+
+	t.Run("script plays alongside", func(t *testing.T) {
+		dir := t.TempDir()
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", filepath.Join(dir, "out.txt"), "-cols", "20", "-rows", "2", "-frames", "100ms,800ms",
+			"-keys", `wait /name/ sleep 200ms "bob" Enter`, `echo name; read x; echo "hi $x"; sleep 30`)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		first, _ := os.ReadFile(filepath.Join(dir, "out-1.txt"))
+		second, _ := os.ReadFile(filepath.Join(dir, "out-2.txt"))
+		if strings.Contains(string(first), "hi bob") || !strings.Contains(string(second), "hi bob") {
+			t.Errorf("Frames = %q and %q, want the reply only in the second", first, second)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "both modes", args: []string{"-frames", "1s", "-every", "1s", "-count", "2"}, want: "-frames cannot be used with -every"},
+		{name: "every without count", args: []string{"-every", "1s"}, want: "-every and -count need each other"},
+		{name: "bad time", args: []string{"-frames", "1s,soon"}, want: `invalid frame time "soon"`},
+		{name: "stdout", args: []string{"-o", "-", "-frames", "1s"}, want: "-o - cannot hold them"},
+		{name: "with wait", args: []string{"-frames", "1s", "-wait-for", "x"}, want: "cannot be used with -wait-for"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", filepath.Join(t.TempDir(), "out.svg")}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, "echo hi")...)
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("Expected failure, got: %s", output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output should contain %q\nOutput: %s", tt.want, output)
+			}
+		})
+	}
+}
+
+func TestTUIRecord(t *testing.T) {
+	buildCmd := exec.Command("go", "build", "-o", "agentshot_test_bin")
+	if err := buildCmd.Run(); err != nil {
+		t.Fatalf("Failed to build: %v", err)
+	}
+	defer os.Remove("agentshot_test_bin")
+
+	steps := "for i in 1 2 3; do echo step $i; sleep 0.3; done"
+	loop := regexp.MustCompile(`\.frame\{visibility:hidden;animation:([0-9.]+)s step-end infinite\}`)
+	tests := []struct {
+		name     string
+		args     []string
+		command  string
+		frames   int
+		duration string
+		want     []string
+	}{
+		{
+			name:    "animated svg",
+			command: steps,
+			frames:  3,
+			want:    []string{`<g class="frame frame-0">`, "@keyframes frame-2{0%{visibility:hidden}", ">step 3<"},
+		},
+		{
+			name:     "idle compression",
+			args:     []string{"-idle-limit", "200ms"},
+			command:  "echo one; sleep 1.5; echo two",
+			frames:   2,
+			duration: "2.200",
+		},
+		{
+			name:     "max duration",
+			args:     []string{"-max-duration", "400ms"},
+			command:  steps,
+			frames:   2,
+			duration: "0.400",
+		},
+		{
+			name:    "synchronized frames",
+			command: `printf 'a\033[?2026h'; sleep 0.3; printf '\033[2J\033[Hb\033[?2026l'`,
+			frames:  2,
+			want:    []string{">a<", ">b<"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-o", "-", "-record", "-cols", "20", "-rows", "4", "-delay", "0"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, tt.command)...)
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+			}
+			svg := string(output)
+			if n := strings.Count(svg, `<g class="frame `); n != tt.frames {
+				t.Errorf("Frames = %d, want %d", n, tt.frames)
+			}
+			m := loop.FindStringSubmatch(svg)
+			if m == nil {
+				t.Fatalf("SVG has no frame animation\nOutput: %s", svg)
+			}
+			if tt.duration != "" && m[1] != tt.duration {
+				t.Errorf("Duration = %ss, want %ss", m[1], tt.duration)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(svg, s) {
+					t.Errorf("SVG should contain %q", s)
+				}
+			}
+		})
+	}
+
+	t.Run("gif", func(t *testing.T) {
+		outPath := filepath.Join(t.TempDir(), "demo.gif")
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", outPath, "-record", "-window", "macos", "-cols", "20", "-rows", "4", "-delay", "0", steps)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		f, err := os.Open(outPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		g, err := gif.DecodeAll(f)
+		if err != nil {
+			t.Fatalf("Invalid GIF: %v", err)
+		}
+		if len(g.Image) != 3 || g.LoopCount != 0 {
+			t.Fatalf("GIF has %d frames and loop count %d, want 3 looping", len(g.Image), g.LoopCount)
+		}
+		if g.Delay[2] != 200 {
+			t.Errorf("Last frame delay = %d, want the 2s hold", g.Delay[2])
+		}
+		if full := image.Rect(0, 0, g.Config.Width, g.Config.Height); g.Image[0].Bounds() != full || g.Image[1].Bounds() == full {
+			t.Errorf("Frame bounds = %v and %v; later frames should only hold changes", g.Image[0].Bounds(), g.Image[1].Bounds())
+		}
+	})
+
+	t.Run("still gif", func(t *testing.T) {
+		cmd := exec.Command("./agentshot_test_bin", "tui", "-o", "-", "-format", "gif", "-cols", "10", "-rows", "2")
+		cmd.Stdin = strings.NewReader("hi")
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("Command failed: %v\nOutput: %s", err, output)
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(output))
+		if err != nil {
+			t.Fatalf("Invalid GIF: %v", err)
+		}
+		if len(g.Image) != 1 || g.Config.Width != 248 {
+			t.Errorf("GIF has %d frames and width %d, want 1 frame 248 wide like the PNG", len(g.Image), g.Config.Width)
+		}
+	})
+
+	errorTests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "png", args: []string{"-o", "-", "-format", "png"}, want: "-record renders to svg or gif"},
+		{name: "fit", args: []string{"-o", "-", "-fit", "box"}, want: "-record cannot be used with -history, -lines or -fit"},
+		{name: "frames", args: []string{"-o", "out.svg", "-frames", "1s"}, want: "-record cannot be used with -frames or -every"},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"tui", "-record"}, tt.args...)
+			cmd := exec.Command("./agentshot_test_bin", append(args, "echo hi")...)
+			output, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatalf("Expected failure, got: %s", output)
+			}
+			if !strings.Contains(string(output), tt.want) {
+				t.Errorf("Output should contain %q\nOutput: %s", tt.want, output)
+			}
+		})
+	}
+}
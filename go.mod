@@ -5,9 +5,13 @@ go 1.24
 toolchain go1.24.11
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/chromedp/chromedp v0.14.2
 	github.com/creack/pty v1.1.24
 	github.com/google/uuid v1.6.0
+	github.com/rivo/uniseg v0.4.7
+	golang.org/x/image v0.29.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -18,4 +22,5 @@ require (
 	github.com/gobwas/pool v0.2.1 // indirect
 	github.com/gobwas/ws v1.4.0 // indirect
 	golang.org/x/sys v0.34.0 // indirect
+	golang.org/x/text v0.27.0 // indirect
 )
@@ -0,0 +1,251 @@
+package tui
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"image"
+	imagecolor "image/color"
+	"image/gif"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const (
+	recordInterval = 50 * time.Millisecond // shortest time between recorded frames
+	lastFrameHold  = 2 * time.Second       // before an animation loops
+)
+
+// recorder keeps the states of the screen during a session, taking a frame
+// whenever the screen has changed, at most every recordInterval.
+type recorder struct {
+	snapshot func(*screen) *frame
+	start    time.Time
+	frames   []timedFrame
+}
+
+// timedFrame is a recorded frame and when it was taken.
+type timedFrame struct {
+	*frame
+	at time.Duration // since the command started
+}
+
+// take records a frame of scr unless nothing visible has changed.
+func (r *recorder) take(scr *screen) {
+	f := r.snapshot(scr)
+	if n := len(r.frames); n > 0 && r.frames[n-1].sameAs(f) {
+		return
+	}
+	r.frames = append(r.frames, timedFrame{frame: f, at: time.Since(r.start)})
+}
+
+// sameAs reports whether two frames render the same.
+func (f *frame) sameAs(g *frame) bool {
+	if f.cols != g.cols || f.rows != g.rows || f.title != g.title ||
+		f.cursor != g.cursor || f.palette != g.palette {
+		return false
+	}
+	for i := range f.cells {
+		if !slices.Equal(f.cells[i], g.cells[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// animFrame is a frame of an animation and how long it shows.
+type animFrame struct {
+	*frame
+	duration time.Duration
+}
+
+// animate turns recorded frames into an animation. Pauses are shortened to
+// idleLimit, the animation is cut off at maxDuration, and the last frame
+// holds for lastFrameHold before the loop restarts. Zero limits are no
+// limits.
+func animate(frames []timedFrame, idleLimit, maxDuration time.Duration) []animFrame {
+	var out []animFrame
+	var elapsed time.Duration
+	for i, tf := range frames {
+		d := lastFrameHold
+		if i+1 < len(frames) {
+			d = frames[i+1].at - tf.at
+			if idleLimit > 0 {
+				d = min(d, idleLimit)
+			}
+		}
+		if maxDuration > 0 && elapsed+d >= maxDuration {
+			out = append(out, animFrame{frame: tf.frame, duration: maxDuration - elapsed})
+			break
+		}
+		out = append(out, animFrame{frame: tf.frame, duration: d})
+		elapsed += d
+	}
+	return out
+}
+
+// renderAnimation renders frames as an animated SVG or GIF.
+func renderAnimation(format outputFormat, frames []animFrame, opts renderOptions) ([]byte, error) {
+	switch format {
+	case formatSVG:
+		return []byte(toAnimatedSVG(frames, opts)), nil
+	case formatGIF:
+		return toGIF(frames, opts)
+	}
+	return nil, fmt.Errorf("recordings render to svg or gif, not %s", formatExts[format])
+}
+
+// writeFrameAnimations writes the CSS that shows each frame in turn, by
+// making it visible for its slot of the loop. The last frame also shows
+// where animations do not run.
+func writeFrameAnimations(buf *bytes.Buffer, frames []animFrame) {
+	var total time.Duration
+	for _, a := range frames {
+		total += a.duration
+	}
+	percent := func(d time.Duration) string {
+		return strconv.FormatFloat(100*d.Seconds()/total.Seconds(), 'f', 3, 64) + "%"
+	}
+
+	fmt.Fprintf(buf, "<style>.frame{visibility:hidden;animation:%.3fs step-end infinite}.frame-%d{visibility:visible}",
+		total.Seconds(), len(frames)-1)
+	var start time.Duration
+	for i, a := range frames {
+		fmt.Fprintf(buf, ".frame-%d{animation-name:frame-%d}@keyframes frame-%d{", i, i, i)
+		if start > 0 {
+			buf.WriteString("0%{visibility:hidden}")
+		}
+		fmt.Fprintf(buf, "%s{visibility:visible}", percent(start))
+		start += a.duration
+		if i < len(frames)-1 {
+			fmt.Fprintf(buf, "%s{visibility:hidden}", percent(start))
+		}
+		buf.WriteString("}")
+	}
+	buf.WriteString("</style>\n")
+}
+
+// toGIF rasterizes frames like toPNG does and encodes them as a looping
+// GIF. After the first frame, only the pixels that changed are stored, and
+// frames that change nothing extend the one before.
+func toGIF(frames []animFrame, opts renderOptions) ([]byte, error) {
+	faces, err := newFaceSet(float64(opts.fontSize) * pngScale)
+	if err != nil {
+		return nil, err
+	}
+	defer faces.close()
+
+	var g gif.GIF
+	var prev *image.RGBA
+	for _, a := range frames {
+		img, err := a.rasterize(opts, faces)
+		if err != nil {
+			return nil, err
+		}
+		flatten(img)
+		// GIF delays are in hundredths of a second.
+		delay := max(int((a.duration+5*time.Millisecond)/(10*time.Millisecond)), 1)
+		r := img.Bounds()
+		if prev != nil {
+			r = changedRect(prev, img)
+			if r.Empty() {
+				g.Delay[len(g.Delay)-1] += delay
+				continue
+			}
+		}
+		g.Image = append(g.Image, quantize(img, r))
+		g.Delay = append(g.Delay, delay)
+		g.Disposal = append(g.Disposal, gif.DisposalNone)
+		prev = img
+	}
+	if len(frames) > 1 {
+		g.LoopCount = 0 // forever
+	} else {
+		g.LoopCount = -1
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &g); err != nil {
+		return nil, fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// flatten composites img over white. GIF pixels are opaque or transparent,
+// with nothing in between for the window shadow.
+func flatten(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		// Pixels are premultiplied by alpha.
+		if a := img.Pix[i+3]; a != 0xff {
+			img.Pix[i] += 0xff - a
+			img.Pix[i+1] += 0xff - a
+			img.Pix[i+2] += 0xff - a
+			img.Pix[i+3] = 0xff
+		}
+	}
+}
+
+// changedRect returns the bounds of the pixels that differ between two
+// images of the same size.
+func changedRect(a, b *image.RGBA) image.Rectangle {
+	var r image.Rectangle
+	bounds := a.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		rowA := a.Pix[a.PixOffset(bounds.Min.X, y):a.PixOffset(bounds.Max.X, y)]
+		rowB := b.Pix[b.PixOffset(bounds.Min.X, y):b.PixOffset(bounds.Max.X, y)]
+		if bytes.Equal(rowA, rowB) {
+			continue
+		}
+		first, last := 0, len(rowA)/4-1
+		for bytes.Equal(rowA[4*first:4*first+4], rowB[4*first:4*first+4]) {
+			first++
+		}
+		for bytes.Equal(rowA[4*last:4*last+4], rowB[4*last:4*last+4]) {
+			last--
+		}
+		r = r.Union(image.Rect(bounds.Min.X+first, y, bounds.Min.X+last+1, y+1))
+	}
+	return r
+}
+
+// quantize converts the part r of img to a paletted image of its 256 most
+// common colors, giving the rest the nearest of those. Terminal frames have
+// few colors besides the antialiasing of text, so this loses little, and
+// unlike dithering it keeps flat areas flat.
+func quantize(img *image.RGBA, r image.Rectangle) *image.Paletted {
+	counts := map[uint32]int{}
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(r.Min.X, y):img.PixOffset(r.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			counts[binary.BigEndian.Uint32(row[i:])]++
+		}
+	}
+	colors := slices.SortedFunc(maps.Keys(counts), func(a, b uint32) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+	colors = colors[:min(len(colors), 256)]
+
+	pal := make(imagecolor.Palette, len(colors))
+	index := make(map[uint32]uint8, len(colors))
+	for i, c := range colors {
+		pal[i] = imagecolor.RGBA{R: uint8(c >> 24), G: uint8(c >> 16), B: uint8(c >> 8), A: uint8(c)}
+		index[c] = uint8(i)
+	}
+	out := image.NewPaletted(r, pal)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		row := img.Pix[img.PixOffset(r.Min.X, y):img.PixOffset(r.Max.X, y)]
+		for i := 0; i < len(row); i += 4 {
+			c := binary.BigEndian.Uint32(row[i:])
+			idx, ok := index[c]
+			if !ok {
+				idx = uint8(pal.Index(imagecolor.RGBA{R: row[i], G: row[i+1], B: row[i+2], A: row[i+3]}))
+				index[c] = idx
+			}
+			out.Pix[out.PixOffset(r.Min.X+i/4, y)] = idx
+		}
+	}
+	return out
+}
@@ -0,0 +1,72 @@
+package tui
+
+import "fmt"
+
+// color is a cell color: the default color, an index into the 256-color
+// palette, or a direct RGB value. Palette colors stay symbolic until the
+// frame is rendered so that they follow changes to the palette.
+type color uint32
+
+const (
+	colorDefault color = 0
+	colorIndexed color = 1 << 24
+	colorRGB     color = 2 << 24
+
+	colorKindMask = 0xff << 24
+)
+
+func indexedColor(n int) color {
+	return colorIndexed | color(min(max(n, 0), 255))
+}
+
+func rgbColor(r, g, b int) color {
+	return colorRGB | color(min(r, 255)<<16|min(g, 255)<<8|min(b, 255))
+}
+
+// palette holds the colors in effect: the theme's, as changed by the
+// program with OSC 4, 10, 11 and 12.
+type palette struct {
+	fg     string
+	bg     string
+	cursor string
+	colors [256]string
+}
+
+func newPalette(t *theme) palette {
+	p := palette{fg: t.fg, bg: t.bg, cursor: t.cursor}
+	for i := range p.colors {
+		p.colors[i] = t.paletteHex(i)
+	}
+	return p
+}
+
+// hex resolves c against the palette, using def for the default color.
+func (p *palette) hex(c color, def string) string {
+	switch c & colorKindMask {
+	case colorIndexed:
+		return p.colors[c&^colorKindMask]
+	case colorRGB:
+		return fmt.Sprintf("#%06x", uint32(c&^colorKindMask))
+	}
+	return def
+}
+
+// paletteHex returns entry n of the 256-color palette. The first 16
+// entries come from the theme; the rest are the fixed color cube and
+// grayscale ramp.
+func (t *theme) paletteHex(n int) string {
+	if n < 16 {
+		return t.ansi[n]
+	}
+	if n >= 232 {
+		// Grayscale
+		gray := (n-232)*10 + 8
+		return fmt.Sprintf("#%02x%02x%02x", gray, gray, gray)
+	}
+	// 216 color cube
+	n -= 16
+	b := n % 6
+	g := (n / 6) % 6
+	r := n / 36
+	return fmt.Sprintf("#%02x%02x%02x", r*51, g*51, b*51)
+}
@@ -0,0 +1,188 @@
+package tui
+
+import "slices"
+
+// setMargins implements DECSTBM. Arguments are one-based and inclusive;
+// invalid regions are ignored as in xterm.
+func (s *screen) setMargins(top, bottom int) {
+	if bottom > s.rows {
+		bottom = s.rows
+	}
+	if top >= bottom {
+		return
+	}
+	s.top, s.bottom = top-1, bottom-1
+	s.setCursor(0, 0)
+}
+
+// setCursor implements absolute positioning (CUP, VPA). In origin mode the
+// row is relative to, and confined by, the scrolling region.
+func (s *screen) setCursor(x, y int) {
+	if s.originMode {
+		y = min(y+s.top, s.bottom)
+	}
+	s.moveTo(x, y)
+}
+
+// cursorUp moves up, stopping at the top margin when starting inside the
+// scrolling region.
+func (s *screen) cursorUp(n int) {
+	limit := 0
+	if s.curY >= s.top {
+		limit = s.top
+	}
+	s.moveTo(s.curX, max(s.curY-n, limit))
+}
+
+// cursorDown moves down, stopping at the bottom margin when starting
+// inside the scrolling region.
+func (s *screen) cursorDown(n int) {
+	limit := s.rows - 1
+	if s.curY <= s.bottom {
+		limit = s.bottom
+	}
+	s.moveTo(s.curX, min(s.curY+n, limit))
+}
+
+// lineFeed implements IND: move down, scrolling the region at its bottom.
+func (s *screen) lineFeed() {
+	switch {
+	case s.curY == s.bottom:
+		s.scrollUp(s.top, s.bottom, 1, true)
+	case s.curY < s.rows-1:
+		s.curY++
+	}
+}
+
+// reverseIndex implements RI: move up, scrolling the region at its top.
+func (s *screen) reverseIndex() {
+	switch {
+	case s.curY == s.top:
+		s.scrollDown(s.top, s.bottom, 1)
+	case s.curY > 0:
+		s.curY--
+	}
+}
+
+// scrollUp moves lines top..bottom up by n, blanking the lines exposed at
+// the bottom. With save, lines scrolled off the top of the primary screen go
+// to the scrollback; others are recycled rather than reallocated.
+func (s *screen) scrollUp(top, bottom, n int, save bool) {
+	region := s.cells[top : bottom+1]
+	n = min(n, len(region))
+	if n <= 0 {
+		return
+	}
+	rotateLines(region, n)
+	keep := save && top == 0 && !s.altActive && s.scrollbackLimit > 0
+	for y := bottom - n + 1; y <= bottom; y++ {
+		if keep {
+			s.cells[y] = s.pushScrollback(s.cells[y])
+		}
+		s.clearCells(y, 0, s.cols)
+	}
+}
+
+// pushScrollback adds a line to the scrollback and returns a line to take
+// its place on screen: the oldest scrollback line, recycled, once the limit
+// is reached, or else a new one.
+func (s *screen) pushScrollback(line []cell) []cell {
+	s.scrollback = append(s.scrollback, line)
+	if len(s.scrollback) <= s.scrollbackLimit {
+		return make([]cell, s.cols)
+	}
+	if s.frozen != nil {
+		// The frozen screen may still show the oldest line.
+		s.scrollback = s.scrollback[1:]
+		return make([]cell, s.cols)
+	}
+	oldest := s.scrollback[0]
+	s.scrollback[0] = nil
+	s.scrollback = s.scrollback[1:]
+	return oldest
+}
+
+// scrollDown moves lines top..bottom down by n, blanking the lines exposed
+// at the top.
+func (s *screen) scrollDown(top, bottom, n int) {
+	region := s.cells[top : bottom+1]
+	n = min(n, len(region))
+	if n <= 0 {
+		return
+	}
+	rotateLines(region, len(region)-n)
+	for y := top; y < top+n; y++ {
+		s.clearCells(y, 0, s.cols)
+	}
+}
+
+// rotateLines rotates lines left by n in place.
+func rotateLines(lines [][]cell, n int) {
+	slices.Reverse(lines[:n])
+	slices.Reverse(lines[n:])
+	slices.Reverse(lines)
+}
+
+// insertLines implements IL. It has no effect outside the scrolling region.
+func (s *screen) insertLines(n int) {
+	if s.curY < s.top || s.curY > s.bottom {
+		return
+	}
+	s.scrollDown(s.curY, s.bottom, n)
+	s.curX = 0
+}
+
+// deleteLines implements DL. It has no effect outside the scrolling region,
+// and deleted lines are gone rather than saved to the scrollback.
+func (s *screen) deleteLines(n int) {
+	if s.curY < s.top || s.curY > s.bottom {
+		return
+	}
+	s.scrollUp(s.curY, s.bottom, n, false)
+	s.curX = 0
+}
+
+// insertChars implements ICH: shift the rest of the line right by n,
+// discarding characters pushed past the right edge. A wide character
+// split by the cursor or by the edge is blanked.
+func (s *screen) insertChars(n int) {
+	s.curX = min(s.curX, s.cols-1)
+	line := s.cells[s.curY]
+	n = min(n, s.cols-s.curX)
+	if line[s.curX].ch == "" {
+		s.splitWide(line, s.curX)
+	}
+	copy(line[s.curX+n:], line[s.curX:])
+	s.clearCells(s.curY, s.curX, s.curX+n)
+	if last := line[s.cols-1]; last.wide {
+		line[s.cols-1] = cell{ch: " ", style: style{bg: last.bg}}
+	}
+}
+
+// deleteChars implements DCH: shift the rest of the line left by n,
+// blanking the cells exposed at the right edge. A wide character only
+// partly deleted is blanked.
+func (s *screen) deleteChars(n int) {
+	s.curX = min(s.curX, s.cols-1)
+	line := s.cells[s.curY]
+	n = min(n, s.cols-s.curX)
+	s.splitWide(line, s.curX)
+	s.splitWide(line, s.curX+n-1)
+	copy(line[s.curX:], line[s.curX+n:])
+	s.clearCells(s.curY, s.cols-n, s.cols)
+}
+
+// eraseChars implements ECH: blank n cells from the cursor without moving it.
+func (s *screen) eraseChars(n int) {
+	x := min(s.curX, s.cols-1)
+	s.eraseCells(s.curY, x, min(x+n, s.cols))
+}
+
+// eraseCells blanks cells from..to-1 of a row, along with the other half
+// of a wide character cut at either end.
+func (s *screen) eraseCells(row, from, to int) {
+	line := s.cells[row]
+	s.splitWide(line, from)
+	s.splitWide(line, to-1)
+	s.clearCells(row, from, to)
+}
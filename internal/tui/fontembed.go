@@ -0,0 +1,376 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// embeddedFamily is the font-family name embedded fonts are declared under.
+const embeddedFamily = "agentshot-embedded"
+
+// bundledFontName selects the bundled Go Mono family for -embed-font.
+const bundledFontName = "go-mono"
+
+// svgFont is a font to embed in SVGs, so that they render the same
+// everywhere. Each style is subset to the glyphs a frame uses.
+type svgFont struct {
+	faces   [4][]byte // regular, bold, italic, bold italic; only regular for user fonts
+	advance float64   // cell width relative to the font size
+}
+
+// loadSVGFont loads the bundled Go Mono family, or a TrueType or OpenType
+// file whose styles the viewer synthesizes.
+func loadSVGFont(name string) (*svgFont, error) {
+	f := &svgFont{}
+	if name == bundledFontName {
+		f.faces = [4][]byte{gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF}
+	} else {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %w", err)
+		}
+		f.faces[0] = data
+	}
+
+	sf, err := sfnt.Parse(f.faces[0])
+	if err != nil {
+		return nil, fmt.Errorf("font %s: %w", name, err)
+	}
+	if _, err := fontTables(f.faces[0]); err != nil {
+		return nil, fmt.Errorf("font %s: %w", name, err)
+	}
+	// Lay out the grid with the font's own advance rather than assuming
+	// the usual 0.6em.
+	var buf sfnt.Buffer
+	for _, r := range "0 " {
+		gid, err := sf.GlyphIndex(&buf, r)
+		if err != nil || gid == 0 {
+			continue
+		}
+		unitsPerEm := fixed.Int26_6(sf.UnitsPerEm())
+		adv, err := sf.GlyphAdvance(&buf, gid, unitsPerEm, font.HintingNone)
+		if err == nil && adv > 0 {
+			f.advance = float64(adv) / float64(unitsPerEm)
+			break
+		}
+	}
+	if f.advance == 0 {
+		return nil, fmt.Errorf("font %s: no advance width for digits or spaces", name)
+	}
+	return f, nil
+}
+
+// css returns @font-face rules for the styles in use, each subset to the
+// runes it draws. used is indexed like faces.
+func (f *svgFont) css(used [4]map[rune]bool) string {
+	if f.faces[1] == nil {
+		// A single face serves every style.
+		all := map[rune]bool{}
+		for _, runes := range used {
+			for r := range runes {
+				all[r] = true
+			}
+		}
+		used = [4]map[rune]bool{all}
+	}
+
+	var b strings.Builder
+	for i, face := range f.faces {
+		if face == nil || len(used[i]) == 0 {
+			continue
+		}
+		data, err := subsetFont(face, used[i])
+		if err != nil {
+			// Embedding the whole font is larger but still correct.
+			data = face
+		}
+		format, mime := "truetype", "font/ttf"
+		if bytes.HasPrefix(data, []byte("OTTO")) {
+			format, mime = "opentype", "font/otf"
+		}
+		weight, style := "normal", "normal"
+		if f.faces[1] != nil && i&1 != 0 {
+			weight = "bold"
+		}
+		if f.faces[1] != nil && i&2 != 0 {
+			style = "italic"
+		}
+		fmt.Fprintf(&b, "@font-face{font-family:%s;font-weight:%s;font-style:%s;src:url(data:%s;base64,%s) format('%s')}",
+			embeddedFamily, weight, style, mime, base64.StdEncoding.EncodeToString(data), format)
+	}
+	return b.String()
+}
+
+// usedRunes collects the runes drawn in each font style, indexed like
+// svgFont.faces, plus those of the window title.
+func (f *frame) usedRunes(title string) [4]map[rune]bool {
+	var used [4]map[rune]bool
+	for i := range used {
+		used[i] = map[rune]bool{}
+	}
+	for _, line := range f.cells {
+		for _, c := range line {
+			if c.isBlank() || c.invisible {
+				continue
+			}
+			i := 0
+			if c.bold {
+				i |= 1
+			}
+			if c.italic {
+				i |= 2
+			}
+			for _, r := range c.ch {
+				used[i][r] = true
+			}
+		}
+	}
+	for _, r := range title {
+		used[0][r] = true
+	}
+	return used
+}
+
+// fontTable is an entry of an sfnt table directory.
+type fontTable struct {
+	tag  string
+	data []byte
+}
+
+// fontTables splits an sfnt font into its tables, in directory order.
+func fontTables(data []byte) ([]fontTable, error) {
+	if len(data) < 12 {
+		return nil, errors.New("truncated font")
+	}
+	if string(data[:4]) == "ttcf" {
+		return nil, errors.New("font collections are not supported")
+	}
+	n := int(binary.BigEndian.Uint16(data[4:]))
+	if len(data) < 12+16*n {
+		return nil, errors.New("truncated table directory")
+	}
+	tables := make([]fontTable, n)
+	for i := range tables {
+		rec := data[12+16*i:]
+		offset, length := binary.BigEndian.Uint32(rec[8:]), binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(data)) {
+			return nil, fmt.Errorf("table %q out of bounds", rec[:4])
+		}
+		tables[i] = fontTable{tag: string(rec[:4]), data: data[offset : offset+length]}
+	}
+	return tables, nil
+}
+
+// subsetFont removes the outlines of glyphs that draw none of runes from a
+// TrueType font. Glyph IDs are kept so that cmap, hmtx and layout tables
+// stay valid; unused glyphs just become empty, which is where nearly all
+// of the size is. CFF-flavored OpenType fonts are returned whole.
+func subsetFont(data []byte, runes map[rune]bool) ([]byte, error) {
+	if bytes.HasPrefix(data, []byte("OTTO")) {
+		return data, nil
+	}
+	sf, err := sfnt.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := fontTables(data)
+	if err != nil {
+		return nil, err
+	}
+	table := func(tag string) []byte {
+		for _, t := range tables {
+			if t.tag == tag {
+				return t.data
+			}
+		}
+		return nil
+	}
+	head, loca, glyf := table("head"), table("loca"), table("glyf")
+	if len(head) < 54 || loca == nil || glyf == nil {
+		return nil, errors.New("missing TrueType tables")
+	}
+	longLoca := binary.BigEndian.Uint16(head[50:]) != 0
+	numGlyphs := sf.NumGlyphs()
+
+	offsets := make([]uint32, numGlyphs+1)
+	for i := range offsets {
+		if longLoca {
+			if len(loca) < 4*(i+1) {
+				return nil, errors.New("truncated loca table")
+			}
+			offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		} else {
+			if len(loca) < 2*(i+1) {
+				return nil, errors.New("truncated loca table")
+			}
+			offsets[i] = uint32(binary.BigEndian.Uint16(loca[2*i:])) * 2
+		}
+	}
+	glyph := func(gid int) []byte {
+		start, end := offsets[gid], offsets[gid+1]
+		if start >= end || end > uint32(len(glyf)) {
+			return nil
+		}
+		return glyf[start:end]
+	}
+
+	// Keep .notdef, the glyphs for the runes and the components of
+	// composite glyphs.
+	keep := map[int]bool{0: true}
+	var queue []int
+	var buf sfnt.Buffer
+	for r := range runes {
+		if gid, err := sf.GlyphIndex(&buf, r); err == nil && gid != 0 && !keep[int(gid)] {
+			keep[int(gid)] = true
+			queue = append(queue, int(gid))
+		}
+	}
+	for len(queue) > 0 {
+		gid := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+		for _, c := range glyphComponents(glyph(gid)) {
+			if c < numGlyphs && !keep[c] {
+				keep[c] = true
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	var newGlyf, newLoca bytes.Buffer
+	for gid := 0; gid <= numGlyphs; gid++ {
+		if longLoca {
+			binary.Write(&newLoca, binary.BigEndian, uint32(newGlyf.Len()))
+		} else {
+			binary.Write(&newLoca, binary.BigEndian, uint16(newGlyf.Len()/2))
+		}
+		if gid < numGlyphs && keep[gid] {
+			newGlyf.Write(glyph(gid))
+			for newGlyf.Len()%4 != 0 {
+				newGlyf.WriteByte(0)
+			}
+		}
+	}
+
+	out := tables[:0:0]
+	for _, t := range tables {
+		switch t.tag {
+		case "DSIG":
+			// The signature no longer matches.
+			continue
+		case "glyf":
+			t.data = newGlyf.Bytes()
+		case "loca":
+			t.data = newLoca.Bytes()
+		case "head":
+			t.data = slices.Clone(t.data)
+			binary.BigEndian.PutUint32(t.data[8:], 0) // checkSumAdjustment, set below
+		case "post":
+			if len(t.data) >= 32 {
+				// Version 3 drops the glyph names.
+				t.data = slices.Clone(t.data[:32])
+				binary.BigEndian.PutUint32(t.data, 0x00030000)
+			}
+		}
+		out = append(out, t)
+	}
+	return writeFont(data[:4], out), nil
+}
+
+// glyphComponents returns the glyph IDs a composite glyph is built from.
+func glyphComponents(g []byte) []int {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	const (
+		argsAreWords   = 0x0001
+		haveScale      = 0x0008
+		moreComponents = 0x0020
+		haveXYScale    = 0x0040
+		haveTwoByTwo   = 0x0080
+	)
+	var ids []int
+	for p := 10; p+4 <= len(g); {
+		flags := binary.BigEndian.Uint16(g[p:])
+		ids = append(ids, int(binary.BigEndian.Uint16(g[p+2:])))
+		p += 4
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return ids
+}
+
+// writeFont assembles an sfnt font from its tables, computing the table
+// checksums and the head table's checkSumAdjustment.
+func writeFont(version []byte, tables []fontTable) []byte {
+	n := len(tables)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := 16 << entrySelector
+
+	var out bytes.Buffer
+	out.Write(version)
+	binary.Write(&out, binary.BigEndian, []uint16{uint16(n), uint16(searchRange), uint16(entrySelector), uint16(n*16 - searchRange)})
+
+	offset := 12 + 16*n
+	headOffset := -1
+	for _, t := range tables {
+		if t.tag == "head" {
+			headOffset = offset
+		}
+		out.WriteString(t.tag)
+		binary.Write(&out, binary.BigEndian, []uint32{fontChecksum(t.data), uint32(offset), uint32(len(t.data))})
+		offset += (len(t.data) + 3) &^ 3
+	}
+	for _, t := range tables {
+		out.Write(t.data)
+		for out.Len()%4 != 0 {
+			out.WriteByte(0)
+		}
+	}
+
+	font := out.Bytes()
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(font[headOffset+8:], 0xB1B0AFBA-fontChecksum(font))
+	}
+	return font
+}
+
+func fontChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
@@ -0,0 +1,79 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// outputFormat is the file format a frame is rendered to.
+type outputFormat int
+
+const (
+	formatSVG outputFormat = iota
+	formatPNG
+	formatText
+	formatANSI
+	formatJSON
+	formatHTML
+	formatGIF
+)
+
+// formatExts maps output formats to their file extension.
+var formatExts = map[outputFormat]string{
+	formatSVG:  ".svg",
+	formatPNG:  ".png",
+	formatText: ".txt",
+	formatANSI: ".ans",
+	formatJSON: ".json",
+	formatHTML: ".html",
+	formatGIF:  ".gif",
+}
+
+// formatNames maps -format values to output formats.
+var formatNames = map[string]outputFormat{
+	"svg":  formatSVG,
+	"png":  formatPNG,
+	"txt":  formatText,
+	"ansi": formatANSI,
+	"json": formatJSON,
+	"html": formatHTML,
+	"gif":  formatGIF,
+}
+
+// parseFormat returns the format named by the -format flag or, if it is
+// empty, the one implied by the output path's extension, defaulting to SVG.
+func parseFormat(name, outputPath string) (outputFormat, error) {
+	if name == "" {
+		ext := strings.ToLower(filepath.Ext(outputPath))
+		for format, formatExt := range formatExts {
+			if ext == formatExt {
+				return format, nil
+			}
+		}
+		return formatSVG, nil
+	}
+	if format, ok := formatNames[name]; ok {
+		return format, nil
+	}
+	return 0, fmt.Errorf("invalid format %q (want svg, png, gif, txt, ansi, json or html)", name)
+}
+
+// render renders the frame in the given format.
+func (f *frame) render(format outputFormat, opts renderOptions) ([]byte, error) {
+	switch format {
+	case formatPNG:
+		return f.toPNG(opts)
+	case formatText:
+		return []byte(f.toText()), nil
+	case formatANSI:
+		return []byte(f.toANSI()), nil
+	case formatJSON:
+		return f.toJSON()
+	case formatHTML:
+		return []byte(f.toHTML(opts)), nil
+	case formatGIF:
+		return toGIF([]animFrame{{frame: f}}, opts)
+	}
+	return []byte(f.toSVG(opts)), nil
+}
@@ -0,0 +1,206 @@
+package tui
+
+import (
+	"fmt"
+	"math"
+)
+
+// bufferMode selects which screen buffer a snapshot is taken from.
+type bufferMode int
+
+const (
+	bufferActive bufferMode = iota
+	bufferPrimary
+	bufferAlternate
+)
+
+func parseBufferMode(name string) (bufferMode, error) {
+	switch name {
+	case "active":
+		return bufferActive, nil
+	case "primary":
+		return bufferPrimary, nil
+	case "alternate", "alt":
+		return bufferAlternate, nil
+	}
+	return 0, fmt.Errorf("invalid buffer %q (want active, primary or alternate)", name)
+}
+
+// frame is an immutable copy of a screen buffer, taken for rendering.
+type frame struct {
+	cells   [][]cell
+	cols    int
+	rows    int
+	title   string // set by the program with OSC 0 or 2
+	cursor  frameCursor
+	palette palette
+}
+
+// frameCursor is the cursor as the program left it.
+type frameCursor struct {
+	x, y    int
+	visible bool
+	shape   cursorShape
+}
+
+// cursorShape is a cursor style set with DECSCUSR, or the -cursor flag
+// value choosing how to draw it.
+type cursorShape int
+
+const (
+	cursorNone cursorShape = iota // do not draw the cursor
+	cursorAuto                    // draw it with the shape the program chose
+	cursorBlock
+	cursorUnderline
+	cursorBar
+)
+
+func parseCursorShape(name string) (cursorShape, error) {
+	switch name {
+	case "none", "":
+		return cursorNone, nil
+	case "auto":
+		return cursorAuto, nil
+	case "block":
+		return cursorBlock, nil
+	case "underline":
+		return cursorUnderline, nil
+	case "bar":
+		return cursorBar, nil
+	}
+	return 0, fmt.Errorf("invalid cursor %q (want none, auto, block, underline or bar)", name)
+}
+
+// cursorShapeFor maps a DECSCUSR parameter to a shape. Blinking and steady
+// variants are drawn the same.
+func cursorShapeFor(ps int) cursorShape {
+	switch ps {
+	case 3, 4:
+		return cursorUnderline
+	case 5, 6:
+		return cursorBar
+	}
+	return cursorBlock
+}
+
+// allLines asks snapshot for the whole scrollback.
+const allLines = math.MaxInt
+
+// snapshot copies the selected buffer so it can be rendered while the
+// screen keeps changing. lines is the number of lines to take, counting up
+// from the bottom of the screen into the scrollback; 0 takes the screen
+// alone. The alternate buffer has no scrollback. During a synchronized
+// update, the copy is of the screen as it was before the update.
+func (s *screen) snapshot(mode bufferMode, lines int) *frame {
+	s = s.visible()
+	src := s.cells
+	switch mode {
+	case bufferPrimary:
+		src = s.primary
+	case bufferAlternate:
+		src = s.alternate
+	}
+	offset := 0 // rows added above the screen; negative if it is cropped
+	if lines > 0 {
+		var history [][]cell
+		if mode == bufferPrimary || mode == bufferActive && !s.altActive {
+			history = s.scrollback
+		}
+		all := append(history[:len(history):len(history)], src...)
+		lines = min(lines, len(all))
+		offset = lines - len(src)
+		src = all[len(all)-lines:]
+	}
+
+	f := &frame{
+		cells:   make([][]cell, len(src)),
+		cols:    s.cols,
+		rows:    len(src),
+		title:   s.title,
+		palette: s.palette,
+		cursor: frameCursor{
+			x: min(s.curX, s.cols-1),
+			y: s.curY + offset,
+			// The cursor belongs to the active buffer only.
+			visible: !s.cursorHidden && (mode == bufferActive ||
+				(mode == bufferAlternate) == s.altActive) && s.curY+offset >= 0,
+			shape: s.cursorShape,
+		},
+	}
+	for i, line := range src {
+		f.cells[i] = append([]cell(nil), line...)
+	}
+	return f
+}
+
+// fitMode selects how a frame is cropped to its content.
+type fitMode int
+
+const (
+	fitNone fitMode = iota
+	fitTrim         // drop empty rows at the bottom and columns at the right
+	fitBox          // crop to the bounding box of painted cells
+)
+
+func parseFitMode(name string) (fitMode, error) {
+	switch name {
+	case "none", "":
+		return fitNone, nil
+	case "trim":
+		return fitTrim, nil
+	case "box":
+		return fitBox, nil
+	}
+	return 0, fmt.Errorf("invalid fit %q (want none, trim or box)", name)
+}
+
+// fit crops the frame to the cells that paint something, keeping at least
+// minCols by minRows where the frame has them. The cursor counts as content
+// when withCursor is set, and is hidden if it ends up outside the frame.
+func (f *frame) fit(mode fitMode, minCols, minRows int, withCursor bool) {
+	if mode == fitNone {
+		return
+	}
+	top, left, bottom, right := len(f.cells), f.cols, 0, 0 // bottom and right exclusive
+	include := func(x, y int) {
+		top, left = min(top, y), min(left, x)
+		bottom, right = max(bottom, y+1), max(right, x+1)
+	}
+	for y, line := range f.cells {
+		for x, c := range line {
+			if c.isBlank() {
+				continue
+			}
+			include(x, y)
+			if c.wide && x+1 < len(line) {
+				include(x+1, y)
+			}
+		}
+	}
+	if withCursor && f.cursor.visible {
+		include(f.cursor.x, f.cursor.y)
+	}
+	if bottom == 0 {
+		top, left, bottom, right = 0, 0, 1, 1 // nothing painted: keep one cell
+	}
+	if mode == fitTrim {
+		top, left = 0, 0
+	}
+
+	// Grow to the minimum size, to the right and down where there is room.
+	right = min(max(right, left+minCols), f.cols)
+	left = max(min(left, right-minCols), 0)
+	bottom = min(max(bottom, top+minRows), len(f.cells))
+	top = max(min(top, bottom-minRows), 0)
+
+	f.cells = f.cells[top:bottom]
+	for i, line := range f.cells {
+		f.cells[i] = line[left:right]
+	}
+	f.cols, f.rows = right-left, bottom-top
+	f.cursor.x -= left
+	f.cursor.y -= top
+	if f.cursor.x < 0 || f.cursor.x >= f.cols || f.cursor.y < 0 || f.cursor.y >= f.rows {
+		f.cursor.visible = false
+	}
+}
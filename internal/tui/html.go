@@ -0,0 +1,113 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// toHTML renders the frame as a self-contained HTML page holding a <pre>
+// with inline styles.
+func (f *frame) toHTML(opts renderOptions) string {
+	p := &f.palette
+	fontFamily := sanitizeFontFamily(opts.fontFamily)
+	title := cmp.Or(f.title, opts.title, "agentshot")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+`, html.EscapeString(title))
+	if opts.font != nil {
+		b.WriteString(opts.font.css(f.usedRunes("")))
+		b.WriteString("\n")
+		fontFamily = embeddedFamily + ", " + fontFamily
+	}
+	fmt.Fprintf(&b, `body{margin:0;background:%[1]s}
+pre{margin:0;padding:20px;font-family:%[3]s;font-size:%[4]dpx;line-height:1.2;color:%[2]s;background:%[1]s}
+a{color:inherit}
+.blink{animation:blink 1s steps(1) infinite}@keyframes blink{50%%{opacity:0}}
+</style>
+</head>
+<body>
+<pre>`, p.bg, p.fg, fontFamily, opts.fontSize)
+
+	for i, line := range f.cells {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		for _, s := range spans(line, usedWidth(line)) {
+			text := html.EscapeString(s.text)
+			if href := safeLink(s.link); href != "" {
+				text = fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(href), text)
+			}
+			if css := spanCSS(p, s.style); css != "" || s.blink {
+				class := ""
+				if s.blink {
+					class = ` class="blink"`
+				}
+				fmt.Fprintf(&b, `<span%s style="%s">%s</span>`, class, css, text)
+			} else {
+				b.WriteString(text)
+			}
+		}
+	}
+	b.WriteString("</pre>\n</body>\n</html>\n")
+	return b.String()
+}
+
+// spanCSS returns the inline CSS for a style, or "" for the default one.
+func spanCSS(p *palette, st style) string {
+	var css []string
+	fg, bg := st.colors(p)
+	if fg != p.fg {
+		css = append(css, "color:"+fg)
+	}
+	if bg != "" {
+		css = append(css, "background:"+bg)
+	}
+	if st.bold {
+		css = append(css, "font-weight:bold")
+	}
+	if st.italic {
+		css = append(css, "font-style:italic")
+	}
+	if st.dim {
+		css = append(css, "opacity:0.5")
+	}
+	if st.invisible {
+		css = append(css, "visibility:hidden")
+	}
+
+	var lines []string
+	if st.underline != underlineNone {
+		lines = append(lines, "underline")
+	}
+	if st.strike {
+		lines = append(lines, "line-through")
+	}
+	if st.overline {
+		lines = append(lines, "overline")
+	}
+	if len(lines) > 0 {
+		css = append(css, "text-decoration-line:"+strings.Join(lines, " "))
+	}
+	switch st.underline {
+	case underlineDouble:
+		css = append(css, "text-decoration-style:double")
+	case underlineCurly:
+		css = append(css, "text-decoration-style:wavy")
+	case underlineDotted:
+		css = append(css, "text-decoration-style:dotted")
+	case underlineDashed:
+		css = append(css, "text-decoration-style:dashed")
+	}
+	if st.underline != underlineNone && st.ulColor != colorDefault {
+		css = append(css, "text-decoration-color:"+p.hex(st.ulColor, fg))
+	}
+	return strings.Join(css, ";")
+}
@@ -0,0 +1,162 @@
+package tui
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// jsonFrame is the JSON form of a frame: a grid of every cell, addressed
+// as cells[y][x], and the text of each line with its styled spans as a more
+// compact form.
+type jsonFrame struct {
+	Cols       int          `json:"cols"`
+	Rows       int          `json:"rows"`
+	Title      string       `json:"title,omitempty"`
+	Foreground string       `json:"foreground"`
+	Background string       `json:"background"`
+	Cursor     jsonCursor   `json:"cursor"`
+	Cells      [][]jsonCell `json:"cells"`
+	Lines      []jsonLine   `json:"lines"`
+}
+
+// jsonCursor is the cursor. Its position is omitted when it is hidden or
+// outside the frame.
+type jsonCursor struct {
+	X       *int   `json:"x,omitempty"`
+	Y       *int   `json:"y,omitempty"`
+	Visible bool   `json:"visible"`
+	Shape   string `json:"shape"`
+}
+
+// jsonCell is a cell of the grid. A wide character has width 2, and the
+// cell to its right is its continuation, with no text and width 0.
+// Concealed cells are blanks of width 1.
+type jsonCell struct {
+	Ch    string `json:"ch"`
+	Width int    `json:"width"`
+	jsonStyle
+}
+
+type jsonLine struct {
+	Text  string     `json:"text"`
+	Spans []jsonSpan `json:"spans,omitempty"`
+}
+
+// jsonSpan is a run of styled cells.
+type jsonSpan struct {
+	Col   int    `json:"col"`
+	Width int    `json:"width"`
+	Text  string `json:"text"`
+	jsonStyle
+}
+
+// jsonStyle is the style and link of a cell or span. Colors are resolved to
+// "#rrggbb" and omitted when they are the default, as are unset attributes.
+type jsonStyle struct {
+	Fg             string `json:"fg,omitempty"`
+	Bg             string `json:"bg,omitempty"`
+	Bold           bool   `json:"bold,omitempty"`
+	Dim            bool   `json:"dim,omitempty"`
+	Italic         bool   `json:"italic,omitempty"`
+	Underline      string `json:"underline,omitempty"`
+	UnderlineColor string `json:"underlineColor,omitempty"`
+	Blink          bool   `json:"blink,omitempty"`
+	Reverse        bool   `json:"reverse,omitempty"`
+	Invisible      bool   `json:"invisible,omitempty"`
+	Strike         bool   `json:"strike,omitempty"`
+	Overline       bool   `json:"overline,omitempty"`
+	Link           string `json:"link,omitempty"`
+}
+
+func newJSONStyle(p *palette, st style, link string) jsonStyle {
+	return jsonStyle{
+		Fg:             p.hex(st.fg, ""),
+		Bg:             p.hex(st.bg, ""),
+		Bold:           st.bold,
+		Dim:            st.dim,
+		Italic:         st.italic,
+		Underline:      underlineNames[st.underline],
+		UnderlineColor: p.hex(st.ulColor, ""),
+		Blink:          st.blink,
+		Reverse:        st.reverse,
+		Invisible:      st.invisible,
+		Strike:         st.strike,
+		Overline:       st.overline,
+		Link:           link,
+	}
+}
+
+var underlineNames = map[underlineStyle]string{
+	underlineSingle: "single",
+	underlineDouble: "double",
+	underlineCurly:  "curly",
+	underlineDotted: "dotted",
+	underlineDashed: "dashed",
+}
+
+var cursorShapeNames = map[cursorShape]string{
+	cursorBlock:     "block",
+	cursorUnderline: "underline",
+	cursorBar:       "bar",
+}
+
+// toJSON renders the frame as a JSON grid of cells, with the lines and
+// their styled spans.
+func (f *frame) toJSON() ([]byte, error) {
+	p := &f.palette
+	out := jsonFrame{
+		Cols:       f.cols,
+		Rows:       f.rows,
+		Title:      f.title,
+		Foreground: p.fg,
+		Background: p.bg,
+		Cursor: jsonCursor{
+			Visible: f.cursor.visible,
+			Shape:   cursorShapeNames[f.cursor.shape],
+		},
+		Cells: make([][]jsonCell, len(f.cells)),
+		Lines: make([]jsonLine, len(f.cells)),
+	}
+	if f.cursor.visible {
+		out.Cursor.X, out.Cursor.Y = &f.cursor.x, &f.cursor.y
+	}
+	for i, line := range f.cells {
+		out.Cells[i] = make([]jsonCell, len(line))
+		for x, c := range line {
+			cell := jsonCell{Ch: c.ch, Width: 1, jsonStyle: newJSONStyle(p, c.style, c.link)}
+			switch {
+			case c.invisible:
+				// Concealed cells show as blanks.
+				cell.Ch = " "
+			case c.wide:
+				cell.Width = 2
+			case c.ch == "" && x > 0 && line[x-1].wide:
+				cell.Width = 0
+			case c.ch == "":
+				// Orphaned half of a wide character.
+				cell.Ch = " "
+			}
+			out.Cells[i][x] = cell
+		}
+
+		out.Lines[i].Text = lineText(line)
+		for _, s := range spans(line, usedWidth(line)) {
+			if s.style == defaultStyle && s.link == "" {
+				continue
+			}
+			out.Lines[i].Spans = append(out.Lines[i].Spans, jsonSpan{
+				Col:       s.col,
+				Width:     s.width,
+				Text:      s.text,
+				jsonStyle: newJSONStyle(p, s.style, s.link),
+			})
+		}
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,159 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func (s *screen) oscDispatch(data []byte) {
+	cmd, arg, _ := bytes.Cut(data, []byte(";"))
+	switch string(cmd) {
+	case "0", "2": // Window title (0 also sets the icon name)
+		s.title = cleanTitle(arg)
+	case "8": // Hyperlink: OSC 8 ; params ; URI
+		_, uri, _ := bytes.Cut(arg, []byte(";"))
+		s.link = string(uri)
+	case "4": // Palette: OSC 4 ; index ; spec [; index ; spec ...]
+		args := strings.Split(string(arg), ";")
+		for i := 0; i+1 < len(args); i += 2 {
+			n, err := strconv.Atoi(args[i])
+			if err != nil || n < 0 || n > 255 {
+				continue
+			}
+			s.setColor(&s.palette.colors[n], args[i+1], "4;"+args[i])
+		}
+	case "10", "11", "12": // Default foreground, background and cursor
+		// Extra arguments go on to the following colors, so that
+		// "OSC 10 ; fg ; bg" sets both.
+		n, _ := strconv.Atoi(string(cmd))
+		for _, spec := range strings.Split(string(arg), ";") {
+			if target := s.dynamicColor(n); target != nil {
+				s.setColor(target, spec, strconv.Itoa(n))
+			}
+			n++
+		}
+	case "104": // Reset palette entries, or all of them
+		base := newPalette(s.theme)
+		if len(arg) == 0 {
+			s.palette.colors = base.colors
+		}
+		for _, index := range strings.Split(string(arg), ";") {
+			if n, err := strconv.Atoi(index); err == nil && n >= 0 && n <= 255 {
+				s.palette.colors[n] = base.colors[n]
+			}
+		}
+	case "110", "111", "112": // Reset default foreground, background or cursor
+		n, _ := strconv.Atoi(string(cmd))
+		base := newPalette(s.theme)
+		switch n {
+		case 110:
+			s.palette.fg = base.fg
+		case 111:
+			s.palette.bg = base.bg
+		case 112:
+			s.palette.cursor = base.cursor
+		}
+	}
+}
+
+// cleanTitle returns a window title as valid UTF-8 without control
+// characters, since programs may set it to any bytes.
+func cleanTitle(arg []byte) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, strings.ToValidUTF8(string(arg), "\uFFFD"))
+}
+
+// dynamicColor returns the palette entry for an OSC 10, 11 or 12 color.
+func (s *screen) dynamicColor(n int) *string {
+	switch n {
+	case 10:
+		return &s.palette.fg
+	case 11:
+		return &s.palette.bg
+	case 12:
+		return &s.palette.cursor
+	}
+	return nil
+}
+
+// setColor applies a color spec to a palette entry, or answers with its
+// current value if the spec is "?". Query replies are prefixed with id,
+// the OSC number and any index, as xterm does.
+func (s *screen) setColor(target *string, spec, id string) {
+	if spec == "?" {
+		c := parseHex(*target)
+		s.reply(fmt.Sprintf("\x1b]%s;rgb:%02x%02x/%02x%02x/%02x%02x\x1b\\", id, c[0], c[0], c[1], c[1], c[2], c[2]))
+		return
+	}
+	if c, ok := parseColorSpec(spec); ok {
+		*target = c
+	}
+}
+
+// parseColorSpec parses an X11 color spec, "rgb:r/g/b" with 1 to 4 hex
+// digits per channel or "#rgb" with 1 to 4 digits per channel, into
+// "#rrggbb". Color names are not supported.
+func parseColorSpec(spec string) (string, bool) {
+	var channels []string
+	switch {
+	case strings.HasPrefix(spec, "rgb:"):
+		channels = strings.Split(spec[4:], "/")
+	case strings.HasPrefix(spec, "#") && len(spec) > 1 && (len(spec)-1)%3 == 0:
+		n := (len(spec) - 1) / 3
+		channels = []string{spec[1 : 1+n], spec[1+n : 1+2*n], spec[1+2*n:]}
+	}
+	if len(channels) != 3 {
+		return "", false
+	}
+
+	var rgb [3]uint64
+	for i, ch := range channels {
+		if len(ch) < 1 || len(ch) > 4 {
+			return "", false
+		}
+		v, err := strconv.ParseUint(ch, 16, 16)
+		if err != nil {
+			return "", false
+		}
+		if spec[0] == '#' {
+			// "#" specs give the most significant bits.
+			rgb[i] = v << (4 * (4 - len(ch))) >> 8
+		} else {
+			// "rgb:" specs are scaled: "f" is full intensity.
+			rgb[i] = v * 255 / (1<<(4*len(ch)) - 1)
+		}
+	}
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), true
+}
+
+// linkSchemes are the URL schemes allowed to become clickable in output.
+var linkSchemes = map[string]bool{
+	"http":   true,
+	"https":  true,
+	"ftp":    true,
+	"file":   true,
+	"mailto": true,
+}
+
+// safeLink returns link, normalized, if it is an absolute UTF-8 URL with an
+// allowed scheme, and "" otherwise, so that programs cannot inject
+// javascript: or data: URLs or stray bytes into the output.
+func safeLink(link string) string {
+	if link == "" || !utf8.ValidString(link) || strings.ContainsAny(link, "\x00\n\r\t") {
+		return ""
+	}
+	u, err := url.Parse(link)
+	if err != nil || !linkSchemes[strings.ToLower(u.Scheme)] {
+		return ""
+	}
+	return u.String()
+}
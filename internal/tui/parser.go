@@ -0,0 +1,336 @@
+package tui
+
+import "unicode/utf8"
+
+// parserState is a state of the DEC VT500-series parser described by
+// Paul Williams (https://vt100.net/emu/dec_ansi_parser).
+type parserState uint8
+
+const (
+	stateGround parserState = iota
+	stateEscape
+	stateEscapeIntermediate
+	stateCSIEntry
+	stateCSIParam
+	stateCSIIntermediate
+	stateCSIIgnore
+	stateDCSEntry
+	stateDCSParam
+	stateDCSIntermediate
+	stateDCSPassthrough
+	stateDCSIgnore
+	stateOSCString
+	stateSOSPMAPCString
+)
+
+const (
+	maxParams       = 32
+	maxParamValue   = 65535
+	maxIntermediate = 4
+	maxOSCLength    = 4096
+)
+
+// handler receives the actions emitted by the parser.
+type handler interface {
+	print(r rune)
+	execute(b byte)
+	csiDispatch(params [][]int, intermediates string, final byte)
+	escDispatch(intermediates string, final byte)
+	oscDispatch(data []byte)
+	dcsHook(params [][]int, intermediates string, final byte)
+	dcsPut(b byte)
+	dcsUnhook()
+}
+
+type parser struct {
+	state         parserState
+	values        []int // parameter values, including subparameters
+	ends          []int // end index in values of each parameter group
+	params        [][]int
+	param         int
+	hasParam      bool
+	intermediates []byte
+	ignoring      bool
+	osc           []byte
+	oscTooLong    bool   // the OSC is longer than maxOSCLength and is dropped
+	utf8          []byte // incomplete UTF-8 sequence carried across chunks
+}
+
+func (p *parser) clear() {
+	p.values = p.values[:0]
+	p.ends = p.ends[:0]
+	p.param = 0
+	p.hasParam = false
+	p.intermediates = p.intermediates[:0]
+	p.ignoring = false
+}
+
+// advance runs the parser over data, dispatching actions to h. Data may be
+// split at any byte: escape sequences and UTF-8 sequences that straddle a
+// chunk boundary are completed by the next call.
+func (p *parser) advance(h handler, data []byte) {
+	for _, b := range data {
+		if p.state == stateGround && (b >= utf8.RuneSelf || len(p.utf8) > 0) {
+			p.decodeUTF8(h, b)
+			continue
+		}
+		p.step(h, b)
+	}
+}
+
+func (p *parser) decodeUTF8(h handler, b byte) {
+	if len(p.utf8) > 0 && utf8.RuneStart(b) {
+		// The pending sequence was cut short by a new rune or control.
+		h.print(utf8.RuneError)
+		p.utf8 = p.utf8[:0]
+		if b < utf8.RuneSelf {
+			p.step(h, b)
+			return
+		}
+	}
+	p.utf8 = append(p.utf8, b)
+	if utf8.FullRune(p.utf8) {
+		r, _ := utf8.DecodeRune(p.utf8)
+		h.print(r)
+		p.utf8 = p.utf8[:0]
+	}
+}
+
+func (p *parser) step(h handler, b byte) {
+	// Transitions that apply from any state.
+	switch b {
+	case 0x18, 0x1a: // CAN, SUB
+		p.leave(h)
+		h.execute(b)
+		p.state = stateGround
+		return
+	case 0x1b: // ESC
+		p.leave(h)
+		p.clear()
+		p.state = stateEscape
+		return
+	}
+
+	switch p.state {
+	case stateGround:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b < 0x7f:
+			h.print(rune(b))
+		}
+
+	case stateEscape:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b <= 0x2f:
+			p.collect(b)
+			p.state = stateEscapeIntermediate
+		case b == '[':
+			p.clear()
+			p.state = stateCSIEntry
+		case b == ']':
+			p.osc = p.osc[:0]
+			p.oscTooLong = false
+			p.state = stateOSCString
+		case b == 'P':
+			p.clear()
+			p.state = stateDCSEntry
+		case b == 'X', b == '^', b == '_':
+			p.state = stateSOSPMAPCString
+		case b < 0x7f:
+			h.escDispatch(string(p.intermediates), b)
+			p.state = stateGround
+		}
+
+	case stateEscapeIntermediate:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b <= 0x2f:
+			p.collect(b)
+		case b < 0x7f:
+			h.escDispatch(string(p.intermediates), b)
+			p.state = stateGround
+		}
+
+	case stateCSIEntry, stateCSIParam:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b <= 0x2f:
+			p.collect(b)
+			p.state = stateCSIIntermediate
+		case b <= 0x3b:
+			p.addParam(b)
+			p.state = stateCSIParam
+		case b <= 0x3f:
+			// Private markers are only valid before any parameter.
+			if p.state == stateCSIParam {
+				p.state = stateCSIIgnore
+			} else {
+				p.collect(b)
+				p.state = stateCSIParam
+			}
+		case b < 0x7f:
+			p.csiDispatch(h, b)
+		}
+
+	case stateCSIIntermediate:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b <= 0x2f:
+			p.collect(b)
+		case b <= 0x3f:
+			p.state = stateCSIIgnore
+		case b < 0x7f:
+			p.csiDispatch(h, b)
+		}
+
+	case stateCSIIgnore:
+		switch {
+		case b < 0x20:
+			h.execute(b)
+		case b >= 0x40 && b < 0x7f:
+			p.state = stateGround
+		}
+
+	case stateDCSEntry, stateDCSParam:
+		switch {
+		case b < 0x20:
+			// Ignored.
+		case b <= 0x2f:
+			p.collect(b)
+			p.state = stateDCSIntermediate
+		case b <= 0x3b:
+			p.addParam(b)
+			p.state = stateDCSParam
+		case b <= 0x3f:
+			if p.state == stateDCSParam {
+				p.state = stateDCSIgnore
+			} else {
+				p.collect(b)
+				p.state = stateDCSParam
+			}
+		case b < 0x7f:
+			p.dcsHook(h, b)
+		}
+
+	case stateDCSIntermediate:
+		switch {
+		case b < 0x20:
+			// Ignored.
+		case b <= 0x2f:
+			p.collect(b)
+		case b <= 0x3f:
+			p.state = stateDCSIgnore
+		case b < 0x7f:
+			p.dcsHook(h, b)
+		}
+
+	case stateDCSPassthrough:
+		if b != 0x7f {
+			h.dcsPut(b)
+		}
+
+	case stateDCSIgnore, stateSOSPMAPCString:
+		// Consume everything up to the string terminator.
+
+	case stateOSCString:
+		switch {
+		case b == 0x07: // BEL terminates OSC in xterm.
+			p.oscEnd(h)
+			p.state = stateGround
+		case b >= 0x20 && len(p.osc) < maxOSCLength:
+			p.osc = append(p.osc, b)
+		case b >= 0x20:
+			p.oscTooLong = true
+		}
+	}
+}
+
+// leave performs the exit action of the current state before an
+// anywhere transition.
+func (p *parser) leave(h handler) {
+	switch p.state {
+	case stateOSCString:
+		p.oscEnd(h)
+	case stateDCSPassthrough:
+		h.dcsUnhook()
+	}
+}
+
+// oscEnd dispatches the OSC just terminated, unless it was too long to
+// keep whole: acting on a prefix could, say, link text to a truncated URL.
+func (p *parser) oscEnd(h handler) {
+	if !p.oscTooLong {
+		h.oscDispatch(p.osc)
+	}
+}
+
+func (p *parser) collect(b byte) {
+	if len(p.intermediates) >= maxIntermediate {
+		p.ignoring = true
+		return
+	}
+	p.intermediates = append(p.intermediates, b)
+}
+
+// addParam collects a parameter byte. Parameters are separated by ';' and
+// may carry ':'-separated subparameters, as in "4:3" (curly underline) or
+// "38:2::255:0:0" (RGB foreground), which stay grouped with their parameter.
+func (p *parser) addParam(b byte) {
+	p.hasParam = true
+	switch b {
+	case ';':
+		p.pushParam()
+		p.ends = append(p.ends, len(p.values))
+	case ':':
+		p.pushParam()
+	default:
+		if p.param < maxParamValue {
+			p.param = min(p.param*10+int(b-'0'), maxParamValue)
+		}
+	}
+}
+
+func (p *parser) pushParam() {
+	if len(p.values) < maxParams {
+		p.values = append(p.values, p.param)
+	}
+	p.param = 0
+}
+
+// finishParams closes the parameter being collected and returns the
+// parameter groups. Each group holds the parameter followed by its
+// subparameters and is never empty.
+func (p *parser) finishParams() [][]int {
+	if p.hasParam {
+		p.pushParam()
+		p.ends = append(p.ends, len(p.values))
+	}
+	p.params = p.params[:0]
+	start := 0
+	for _, end := range p.ends {
+		if end > start {
+			p.params = append(p.params, p.values[start:end])
+		}
+		start = end
+	}
+	return p.params
+}
+
+func (p *parser) csiDispatch(h handler, final byte) {
+	params := p.finishParams()
+	if !p.ignoring {
+		h.csiDispatch(params, string(p.intermediates), final)
+	}
+	p.state = stateGround
+}
+
+func (p *parser) dcsHook(h handler, final byte) {
+	h.dcsHook(p.finishParams(), string(p.intermediates), final)
+	p.state = stateDCSPassthrough
+}
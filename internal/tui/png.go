@@ -0,0 +1,385 @@
+package tui
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"image"
+	imagecolor "image/color"
+	"image/draw"
+	"image/png"
+	"math"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/gofont/gomonobolditalic"
+	"golang.org/x/image/font/gofont/gomonoitalic"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+// pngScale is the number of pixels per SVG unit, so that PNGs stay sharp
+// on high-DPI displays while keeping the SVG layout.
+const pngScale = 2
+
+// toPNG rasterizes the frame with the embedded Go Mono fonts, using the
+// same layout as toSVG. Characters missing from Go Mono, such as CJK and
+// emoji, are drawn as boxes.
+func (f *frame) toPNG(opts renderOptions) ([]byte, error) {
+	faces, err := newFaceSet(float64(opts.fontSize) * pngScale)
+	if err != nil {
+		return nil, err
+	}
+	defer faces.close()
+
+	img, err := f.rasterize(opts, faces)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rasterize draws the frame, and its window if any, with faces.
+func (f *frame) rasterize(opts renderOptions, faces *faceSet) (*image.RGBA, error) {
+	fontSize := float64(opts.fontSize)
+	charWidth := fontSize * 0.6
+	lineHeight := fontSize * 1.2
+	padding := 20.0
+
+	termWidth := float64(f.cols)*charWidth + padding*2
+	termHeight := float64(f.rows)*lineHeight + padding*2
+	chrome := newChrome(opts.window, termWidth, termHeight, opts.fontSize)
+	p := &f.palette
+
+	// The window is drawn on its own and then composited with rounded
+	// corners and a shadow.
+	win := newCanvas(termWidth, termHeight+chrome.barHeight)
+	win.rect(0, 0, termWidth, termHeight+chrome.barHeight, p.bg)
+	if chrome.style != windowNone {
+		title := f.title
+		if title == "" {
+			title = opts.title
+		}
+		if err := chrome.drawBar(win, title, p); err != nil {
+			return nil, err
+		}
+	}
+	win.originY = chrome.barHeight
+
+	for row := 0; row < f.rows; row++ {
+		top := padding + float64(row)*lineHeight
+		baseline := top + lineHeight*0.8
+		for col := 0; col < f.cols; col++ {
+			c := f.cells[row][col]
+			if c.isBlank() {
+				continue
+			}
+			width := charWidth
+			if c.wide {
+				width *= 2
+			}
+			x := padding + float64(col)*charWidth
+			fg, bg := c.colors(p)
+			if bg != "" {
+				win.rect(x, top, width, lineHeight, bg)
+			}
+			if c.invisible {
+				continue
+			}
+			if c.dim {
+				fg = mixHex(fg, cmp.Or(bg, p.bg), 0.5)
+			}
+			if c.ch != "" && c.ch != " " {
+				win.text(faces.get(c.bold, c.italic), x, baseline, c.ch, fg)
+			}
+			win.decorations(p, c.style, fg, x, width, baseline, top, fontSize, charWidth)
+		}
+	}
+	if opts.cursor != cursorNone && f.cursor.visible {
+		f.drawCursor(win, faces, opts.cursor, padding, charWidth, lineHeight, fontSize)
+	}
+
+	if chrome.style != windowNone {
+		return chrome.composite(win.img), nil
+	}
+	return win.img, nil
+}
+
+// drawCursor draws the cursor like writeCursor does in SVG.
+func (f *frame) drawCursor(cv *canvas, faces *faceSet, shape cursorShape, padding, charWidth, lineHeight, fontSize float64) {
+	if shape == cursorAuto {
+		shape = f.cursor.shape
+	}
+	col, row := f.cursor.x, f.cursor.y
+	c := f.cells[row][col]
+	if c.ch == "" && col > 0 {
+		col--
+		c = f.cells[row][col]
+	}
+	width := charWidth
+	if c.wide {
+		width *= 2
+	}
+
+	p := &f.palette
+	x := padding + float64(col)*charWidth
+	top := padding + float64(row)*lineHeight
+	thickness := max(1, fontSize/7)
+	switch shape {
+	case cursorBar:
+		cv.rect(x, top, thickness, lineHeight, p.cursor)
+	case cursorUnderline:
+		cv.rect(x, top+lineHeight-thickness, width, thickness, p.cursor)
+	default:
+		cv.rect(x, top, width, lineHeight, p.cursor)
+		if c.ch != "" && c.ch != " " && !c.invisible {
+			cv.text(faces.get(c.bold, c.italic), x, top+lineHeight*0.8, c.ch, p.bg)
+		}
+	}
+}
+
+// faceSet holds the Go Mono faces for each combination of bold and italic.
+type faceSet struct {
+	faces [4]font.Face // regular, bold, italic, bold italic
+}
+
+func newFaceSet(size float64) (*faceSet, error) {
+	fs := &faceSet{}
+	for i, ttf := range [][]byte{gomono.TTF, gomonobold.TTF, gomonoitalic.TTF, gomonobolditalic.TTF} {
+		face, err := newFace(ttf, size)
+		if err != nil {
+			fs.close()
+			return nil, err
+		}
+		fs.faces[i] = face
+	}
+	return fs, nil
+}
+
+func newFace(ttf []byte, size float64) (font.Face, error) {
+	f, err := opentype.Parse(ttf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %w", err)
+	}
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+func (fs *faceSet) get(bold, italic bool) font.Face {
+	i := 0
+	if bold {
+		i |= 1
+	}
+	if italic {
+		i |= 2
+	}
+	return fs.faces[i]
+}
+
+func (fs *faceSet) close() {
+	for _, face := range fs.faces {
+		if face != nil {
+			face.Close()
+		}
+	}
+}
+
+// canvas draws in SVG units onto an image scaled by pngScale. Coordinates
+// are relative to (originX, originY).
+type canvas struct {
+	img              *image.RGBA
+	originX, originY float64
+}
+
+func newCanvas(width, height float64) *canvas {
+	return &canvas{img: image.NewRGBA(image.Rect(0, 0, px(width), px(height)))}
+}
+
+// px converts SVG units to pixels.
+func px(v float64) int {
+	return int(math.Round(v * pngScale))
+}
+
+func rgba(hex string) imagecolor.RGBA {
+	c := parseHex(hex)
+	return imagecolor.RGBA{R: uint8(c[0]), G: uint8(c[1]), B: uint8(c[2]), A: 0xff}
+}
+
+// rect fills a rectangle. Edges are rounded to whole pixels so that
+// adjacent cells meet without seams.
+func (cv *canvas) rect(x, y, w, h float64, hex string) {
+	x, y = x+cv.originX, y+cv.originY
+	r := image.Rect(px(x), px(y), px(x+w), px(y+h))
+	if r.Dy() == 0 {
+		r.Max.Y++
+	}
+	if r.Dx() == 0 {
+		r.Max.X++
+	}
+	draw.Draw(cv.img, r, image.NewUniform(rgba(hex)), image.Point{}, draw.Src)
+}
+
+func (cv *canvas) text(face font.Face, x, baseline float64, s, hex string) {
+	d := font.Drawer{
+		Dst:  cv.img,
+		Src:  image.NewUniform(rgba(hex)),
+		Face: face,
+		Dot:  fixed.P(px(x+cv.originX), px(baseline+cv.originY)),
+	}
+	d.DrawString(s)
+}
+
+// decorations draws underline, strikethrough and overline like
+// writeDecorations does in SVG.
+func (cv *canvas) decorations(p *palette, st style, hex string, x, width, baseline, top, fontSize, charWidth float64) {
+	thickness := max(1, fontSize/14)
+	line := func(y float64, color string) {
+		cv.rect(x, y-thickness/2, width, thickness, color)
+	}
+	dashes := func(y, dash, gap float64, color string) {
+		for dx := 0.0; dx < width; dx += dash + gap {
+			cv.rect(x+dx, y-thickness/2, min(dash, width-dx), thickness, color)
+		}
+	}
+
+	if st.underline != underlineNone {
+		ulColor := p.hex(st.ulColor, hex)
+		y := baseline + fontSize*0.12
+		switch st.underline {
+		case underlineSingle:
+			line(y, ulColor)
+		case underlineDouble:
+			line(y-thickness, ulColor)
+			line(y+thickness*1.5, ulColor)
+		case underlineCurly:
+			// One period per cell, sampled per pixel column.
+			amplitude := max(1.5, thickness*1.5) / 2
+			step := 1.0 / pngScale
+			for dx := 0.0; dx < width; dx += step {
+				dy := -amplitude * math.Sin(2*math.Pi*dx/charWidth)
+				cv.rect(x+dx, y+dy-thickness/2, step, thickness, ulColor)
+			}
+		case underlineDotted:
+			dashes(y, thickness, thickness*2, ulColor)
+		case underlineDashed:
+			dashes(y, charWidth*0.5, charWidth*0.25, ulColor)
+		}
+	}
+	if st.strike {
+		line(baseline-fontSize*0.3, hex)
+	}
+	if st.overline {
+		line(top+thickness/2, hex)
+	}
+}
+
+// drawBar draws the title bar of the window at the top of cv.
+func (c chrome) drawBar(cv *canvas, title string, p *palette) error {
+	titleSize := float64(c.fontSize) * 0.9
+	face, err := newFace(gomono.TTF, titleSize*pngScale)
+	if err != nil {
+		return err
+	}
+	defer face.Close()
+
+	barY := c.barHeight / 2
+	// Center the title's x-height on the bar.
+	baseline := barY + titleSize*0.35
+	switch c.style {
+	case windowMacOS:
+		cv.rect(0, 0, c.termWidth, c.barHeight, mixHex(p.bg, "#ffffff", 0.06))
+		for i, color := range []string{"#ff5f57", "#febc2e", "#28c840"} {
+			cv.fillShape(20+float64(i)*20-6, barY-6, 12, 12, color, func(z *vector.Rasterizer, w, h float32) {
+				circle(z, w/2, h/2, w/2)
+			})
+		}
+		title = truncateTitle(title, c.termWidth-2*90, titleSize)
+		width := float64(font.MeasureString(face, title).Round()) / pngScale
+		cv.text(face, c.termWidth/2-width/2, baseline, title, p.fg)
+	case windowTab:
+		cv.rect(0, 0, c.termWidth, c.barHeight, mixHex(p.bg, "#000000", 0.25))
+		title = truncateTitle(title, c.termWidth-48, titleSize)
+		tabWidth := max(120, float64(len([]rune(title)))*titleSize*0.6+32)
+		tabTop := c.barHeight * 0.25
+		cv.fillShape(8, tabTop, tabWidth, c.barHeight, p.bg, func(z *vector.Rasterizer, w, h float32) {
+			roundedRect(z, w, h, 6*pngScale)
+		})
+		cv.text(face, 24, tabTop+c.barHeight*0.375+titleSize*0.35, title, p.fg)
+	}
+	return nil
+}
+
+// composite places the window on a transparent image with rounded corners
+// and a soft drop shadow.
+func (c chrome) composite(win *image.RGBA) *image.RGBA {
+	width, height := c.size()
+	dst := image.NewRGBA(image.Rect(0, 0, width*pngScale, height*pngScale))
+	winW, winH := win.Bounds().Dx(), win.Bounds().Dy()
+	origin := image.Pt(px(c.margin), px(c.margin))
+
+	// Stacked translucent layers, each smaller than the last, approximate
+	// the blurred shadow of the SVG, which is about half as dark at the
+	// window's edge as under it.
+	const layers = 20
+	alpha := 1 - math.Pow(1-0.25, 1.0/layers)
+	shadow := image.NewUniform(imagecolor.RGBA{A: uint8(alpha * 255)})
+	for i := layers; i > 0; i-- {
+		// Up to 20 units, which with the offset stays inside the margin.
+		spread := float32(i) * 20 / layers * pngScale
+		r := image.Rect(0, 0, winW+int(2*spread), winH+int(2*spread)).
+			Add(origin).Add(image.Pt(-int(spread), -int(spread)+8*pngScale))
+		z := vector.NewRasterizer(r.Dx(), r.Dy())
+		roundedRect(z, float32(r.Dx()), float32(r.Dy()), 10*pngScale+spread)
+		z.Draw(dst, r, shadow, image.Point{})
+	}
+
+	mask := vector.NewRasterizer(winW, winH)
+	roundedRect(mask, float32(winW), float32(winH), 10*pngScale)
+	alphaMask := image.NewAlpha(image.Rect(0, 0, winW, winH))
+	mask.Draw(alphaMask, alphaMask.Bounds(), image.Opaque, image.Point{})
+	draw.DrawMask(dst, win.Bounds().Add(origin), win, image.Point{}, alphaMask, image.Point{}, draw.Over)
+	return dst
+}
+
+// fillShape fills the shape that build draws into a w by h pixel box
+// placed at (x, y).
+func (cv *canvas) fillShape(x, y, w, h float64, hex string, build func(z *vector.Rasterizer, w, h float32)) {
+	x, y = x+cv.originX, y+cv.originY
+	r := image.Rect(px(x), px(y), px(x+w), px(y+h))
+	z := vector.NewRasterizer(r.Dx(), r.Dy())
+	build(z, float32(r.Dx()), float32(r.Dy()))
+	z.Draw(cv.img, r, image.NewUniform(rgba(hex)), image.Point{})
+}
+
+// kappa places cubic Bézier control points to approximate a quarter circle.
+const kappa = 0.5523
+
+func roundedRect(z *vector.Rasterizer, w, h, r float32) {
+	r = min(r, w/2, h/2)
+	k := r * (1 - kappa)
+	z.MoveTo(r, 0)
+	z.LineTo(w-r, 0)
+	z.CubeTo(w-k, 0, w, k, w, r)
+	z.LineTo(w, h-r)
+	z.CubeTo(w, h-k, w-k, h, w-r, h)
+	z.LineTo(r, h)
+	z.CubeTo(k, h, 0, h-k, 0, h-r)
+	z.LineTo(0, r)
+	z.CubeTo(0, k, k, 0, r, 0)
+	z.ClosePath()
+}
+
+func circle(z *vector.Rasterizer, cx, cy, r float32) {
+	k := r * kappa
+	z.MoveTo(cx+r, cy)
+	z.CubeTo(cx+r, cy+k, cx+k, cy+r, cx, cy+r)
+	z.CubeTo(cx-k, cy+r, cx-r, cy+k, cx-r, cy)
+	z.CubeTo(cx-r, cy-k, cx-k, cy-r, cx, cy-r)
+	z.CubeTo(cx+k, cy-r, cx+r, cy-k, cx+r, cy)
+	z.ClosePath()
+}
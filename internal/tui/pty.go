@@ -0,0 +1,252 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+)
+
+// session is a command running in a pseudo-terminal sized to a screen. Its
+// output is fed into the screen as it arrives, so memory use is bounded by
+// the grid rather than by the amount of output.
+type session struct {
+	cmd  *exec.Cmd
+	ptmx *os.File
+	done chan struct{} // closed when the command exits
+
+	// mu guards the screen against the reader, and the input queued for
+	// the command: keystrokes and the answers the screen gives to queries.
+	mu         sync.Mutex
+	scr        *screen
+	stopped    bool
+	lastOutput time.Time
+	rec        *recorder     // if the session is recorded
+	changed    bool          // since the last recorded frame
+	pending    []byte        // input not yet written to the PTY
+	wake       chan struct{} // signals the writer that input is pending
+}
+
+// maxPendingInput bounds the input queued for a command that is not
+// reading it, such as one flooding the screen with queries. Beyond it,
+// input is dropped.
+const maxPendingInput = 64 * 1024
+
+func startSession(command string, scr *screen, rec *recorder) (*session, error) {
+	cmd := exec.Command("bash", "-c", command)
+	cmd.Env = append(os.Environ(),
+		"TERM=xterm-256color",
+		fmt.Sprintf("COLUMNS=%d", scr.cols),
+		fmt.Sprintf("LINES=%d", scr.rows),
+	)
+
+	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
+		Cols: uint16(scr.cols),
+		Rows: uint16(scr.rows),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start pty: %w", err)
+	}
+
+	start := time.Now()
+	s := &session{cmd: cmd, ptmx: ptmx, done: make(chan struct{}), scr: scr, lastOutput: start, rec: rec,
+		wake: make(chan struct{}, 1)}
+	scr.replies = s
+	if rec != nil {
+		rec.start = start
+	}
+	go s.read()
+	go s.write()
+	if rec != nil {
+		go s.record()
+	}
+	go func() {
+		cmd.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+func (s *session) read() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := s.ptmx.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			s.lastOutput = time.Now()
+			if !s.stopped {
+				s.scr.feed(buf[:n])
+				s.changed = true
+			}
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write queues input for the command. The screen calls it with mu held to
+// answer queries, so it must not block on a command that is not reading:
+// the writer goroutine writes the input to the PTY instead.
+func (s *session) Write(p []byte) (int, error) {
+	if !s.stopped && len(s.pending)+len(p) <= maxPendingInput {
+		s.pending = append(s.pending, p...)
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// write writes queued input to the PTY, outside mu, until the command
+// exits.
+func (s *session) write() {
+	for {
+		select {
+		case <-s.wake:
+		case <-s.done:
+			return
+		}
+		s.mu.Lock()
+		input := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+		if _, err := s.ptmx.Write(input); err != nil {
+			return
+		}
+	}
+}
+
+// stop ends the command and stops feeding the screen, so it can be rendered
+// safely even if a background process keeps the PTY open.
+func (s *session) stop() {
+	s.mu.Lock()
+	if s.rec != nil && !s.stopped {
+		s.rec.take(s.scr)
+	}
+	s.stopped = true
+	s.pending = nil
+	s.mu.Unlock()
+	s.cmd.Process.Kill()
+	s.ptmx.Close()
+}
+
+// record takes frames for the recorder as the screen changes, until the
+// session stops.
+func (s *session) record() {
+	tick := time.NewTicker(recordInterval)
+	defer tick.Stop()
+	for range tick.C {
+		s.mu.Lock()
+		if s.stopped {
+			s.mu.Unlock()
+			return
+		}
+		if s.changed {
+			s.rec.take(s.scr)
+			s.changed = false
+		}
+		s.mu.Unlock()
+	}
+}
+
+// text returns the text of the active screen.
+func (s *session) text() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scr.snapshot(bufferActive, 0).toText()
+}
+
+// send types a script step's text or key.
+func (s *session) send(step scriptStep) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	seq := step.text
+	if step.key != "" {
+		seq, _ = keySequence(step.key, s.scr.appCursorKeys)
+	}
+	s.Write([]byte(seq))
+}
+
+// run plays a script against the command, stopping early if it exits.
+// Waits give up after timeout.
+func (s *session) run(steps []scriptStep, timeout time.Duration) error {
+	for _, step := range steps {
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+		switch {
+		case step.wait != nil:
+			if err := s.waitUntil(step.wait.MatchString, fmt.Sprintf("/%s/", step.wait), timeout); err != nil {
+				return err
+			}
+		case step.pause > 0:
+			time.Sleep(step.pause)
+		default:
+			s.send(step)
+			// Let the program read each key on its own, so that Esc
+			// followed by a letter is not taken for Alt and the letter.
+			time.Sleep(keyInterval)
+		}
+	}
+	return nil
+}
+
+// waitError is a wait that was not met. The screen still shows what was
+// there instead.
+type waitError struct {
+	msg string
+}
+
+func (e *waitError) Error() string { return e.msg }
+
+// waitUntil waits until ready holds for the text of the screen. what
+// describes the wait for errors.
+func (s *session) waitUntil(ready func(text string) bool, what string, timeout time.Duration) error {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+	for {
+		if ready(s.text()) {
+			return nil
+		}
+		select {
+		case <-s.done:
+			// Give the last of the output a moment to arrive.
+			time.Sleep(pollInterval)
+			if ready(s.text()) {
+				return nil
+			}
+			return &waitError{fmt.Sprintf("command exited while waiting for %s", what)}
+		case <-deadline:
+			return &waitError{fmt.Sprintf("timed out after %s waiting for %s", timeout, what)}
+		case <-tick.C:
+		}
+	}
+}
+
+// settle waits until the command has written nothing for quiet, so the
+// screen has stopped changing.
+func (s *session) settle(quiet, timeout time.Duration) error {
+	start := time.Now()
+	for {
+		s.mu.Lock()
+		idle := time.Since(s.lastOutput)
+		s.mu.Unlock()
+		if idle >= quiet {
+			return nil
+		}
+		left := timeout - time.Since(start)
+		if left <= 0 {
+			return &waitError{fmt.Sprintf("timed out after %s waiting for %s without output", timeout, quiet)}
+		}
+		time.Sleep(min(quiet-idle, left))
+	}
+}
@@ -0,0 +1,99 @@
+package tui
+
+import "fmt"
+
+// Answers to queries that programs send to learn about the terminal. They
+// go to the program through screen.reply; fzf, readline and crossterm or
+// bubbletea apps wait for them before drawing.
+
+// deviceStatus answers DSR: CSI 5 n (status) and CSI 6 n (cursor
+// position), or DECXCPR, CSI ? 6 n, when private is set.
+func (s *screen) deviceStatus(params [][]int, private bool) {
+	switch param(params, 0, 0) {
+	case 5:
+		if !private {
+			s.reply("\x1b[0n")
+		}
+	case 6:
+		x, y := min(s.curX, s.cols-1), s.curY
+		if s.originMode {
+			y -= s.top
+		}
+		marker := ""
+		if private {
+			marker = "?"
+		}
+		s.reply(fmt.Sprintf("\x1b[%s%d;%dR", marker, y+1, x+1))
+	}
+}
+
+// primaryDeviceAttributes answers DA1 as a VT220 with ANSI color.
+func (s *screen) primaryDeviceAttributes(params [][]int) {
+	if param(params, 0, 0) == 0 {
+		s.reply("\x1b[?62;22c")
+	}
+}
+
+// secondaryDeviceAttributes answers DA2 as a VT220.
+func (s *screen) secondaryDeviceAttributes(params [][]int) {
+	if param(params, 0, 0) == 0 {
+		s.reply("\x1b[>1;10;0c")
+	}
+}
+
+// terminalVersion answers XTVERSION.
+func (s *screen) terminalVersion(params [][]int) {
+	if param(params, 0, 0) == 0 {
+		s.reply("\x1bP>|agentshot\x1b\\")
+	}
+}
+
+// DECRPM mode states.
+const (
+	modeUnknown     = 0
+	modeSet         = 1
+	modeReset       = 2
+	modeAlwaysSet   = 3
+	modeAlwaysReset = 4
+)
+
+// reportMode answers DECRQM for an ANSI mode, or a DEC private mode when
+// private is set.
+func (s *screen) reportMode(params [][]int, private bool) {
+	mode := param(params, 0, 0)
+	state := modeUnknown
+	if private {
+		state = s.privateModeState(mode)
+		s.reply(fmt.Sprintf("\x1b[?%d;%d$y", mode, state))
+		return
+	}
+	switch mode {
+	case 4, 20: // IRM, LNM
+		state = modeAlwaysReset
+	}
+	s.reply(fmt.Sprintf("\x1b[%d;%d$y", mode, state))
+}
+
+func (s *screen) privateModeState(mode int) int {
+	flag := func(on bool) int {
+		if on {
+			return modeSet
+		}
+		return modeReset
+	}
+	switch mode {
+	case 1: // DECCKM
+		return flag(s.appCursorKeys)
+	case 6: // DECOM
+		return flag(s.originMode)
+	case 7: // DECAWM
+		return modeAlwaysSet
+	case 25: // DECTCEM
+		return flag(!s.cursorHidden)
+	case 47, 1047, 1049:
+		return flag(s.altActive)
+	case 2026: // Synchronized output
+		return flag(s.frozen != nil)
+	}
+	return modeUnknown
+}
@@ -0,0 +1,598 @@
+package tui
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"time"
+
+	"github.com/rivo/uniseg"
+)
+
+// cell is one column of the grid. It holds a whole grapheme cluster, so
+// combining marks, variation selectors and ZWJ sequences stay with their
+// base character. A wide cluster is stored in its leading cell with wide
+// set; the cell to its right is a continuation cell with an empty ch.
+type cell struct {
+	ch   string
+	wide bool
+	link string // OSC 8 hyperlink target, if any
+	style
+}
+
+// style holds the graphic rendition (SGR) attributes of a cell.
+type style struct {
+	fg        color
+	bg        color
+	bold      bool
+	dim       bool
+	italic    bool
+	underline underlineStyle
+	ulColor   color // default to use the foreground color
+	blink     bool
+	reverse   bool
+	invisible bool
+	strike    bool
+	overline  bool
+}
+
+var defaultStyle = style{}
+
+type screen struct {
+	cells           [][]cell // active buffer: primary or alternate
+	primary         [][]cell
+	alternate       [][]cell
+	altActive       bool
+	cols            int
+	rows            int
+	curX            int
+	curY            int
+	top             int // scrolling region, zero-based and inclusive
+	bottom          int
+	originMode      bool
+	pen             style          // attributes applied to newly written cells
+	link            string         // active OSC 8 hyperlink
+	title           string         // window title set with OSC 0 or 2
+	cursorHidden    bool           // DECTCEM reset
+	appCursorKeys   bool           // DECCKM: arrow keys send SS3 sequences
+	cursorShape     cursorShape    // DECSCUSR
+	saved           [2]cursorState // DECSC state for the primary and alternate buffers
+	theme           *theme         // colors before any changes by the program
+	palette         palette
+	replies         io.Writer // where answers to queries go, if anywhere
+	scrollback      [][]cell  // lines scrolled off the primary screen, oldest first
+	scrollbackLimit int       // maximum number of scrollback lines
+	frozen          *screen   // the screen as it was when a synchronized update began
+	frozenAt        time.Time
+	parser          parser
+}
+
+// cursorState is the state saved by DECSC and restored by DECRC.
+type cursorState struct {
+	x, y   int
+	pen    style
+	origin bool
+}
+
+func newScreen(cols, rows int, t *theme) *screen {
+	s := &screen{
+		theme:       t,
+		palette:     newPalette(t),
+		cols:        cols,
+		rows:        rows,
+		bottom:      rows - 1,
+		primary:     newGrid(cols, rows),
+		alternate:   newGrid(cols, rows),
+		cursorShape: cursorBlock,
+		pen:         defaultStyle,
+	}
+	s.cells = s.primary
+	s.saved[0] = s.cursor()
+	s.saved[1] = s.cursor()
+	return s
+}
+
+func newGrid(cols, rows int) [][]cell {
+	grid := make([][]cell, rows)
+	for i := range grid {
+		grid[i] = blankLine(cols)
+	}
+	return grid
+}
+
+func (s *screen) write(r rune) {
+	if r >= 0x300 && s.extendCluster(r) {
+		return
+	}
+
+	ch := runeString(r)
+	w := clusterWidth(ch)
+	if w == 0 {
+		// Zero-width characters with nothing to attach to have no cell.
+		return
+	}
+	if w > s.cols {
+		w = 1
+	}
+	if s.curX+w > s.cols {
+		// Deferred wrap: the previous character filled the last column, or
+		// a wide character does not fit in the remaining one.
+		if s.curX < s.cols {
+			s.clearCells(s.curY, s.curX, s.cols)
+		}
+		s.newline()
+	}
+
+	line := s.cells[s.curY]
+	s.splitWide(line, s.curX)
+	s.splitWide(line, s.curX+w-1)
+	line[s.curX] = cell{ch: ch, wide: w == 2, link: s.link, style: s.pen}
+	if w == 2 {
+		line[s.curX+1] = cell{link: s.link, style: s.pen}
+	}
+	s.curX += w
+}
+
+// extendCluster appends r to the cell before the cursor if the two form a
+// single grapheme cluster, widening the cell when the cluster becomes wide
+// (for example a regional indicator pair or an emoji variation selector).
+func (s *screen) extendCluster(r rune) bool {
+	x := min(s.curX, s.cols) - 1
+	if x < 0 {
+		return false
+	}
+	line := s.cells[s.curY]
+	if line[x].ch == "" && x > 0 {
+		x--
+	}
+	prev := &line[x]
+	if prev.ch == "" || prev.ch == " " {
+		return false
+	}
+
+	cluster := prev.ch + string(r)
+	if first, _, _, _ := uniseg.FirstGraphemeClusterInString(cluster, -1); first != cluster {
+		return false
+	}
+	prev.ch = cluster
+
+	if !prev.wide && clusterWidth(cluster) == 2 && x+1 < s.cols {
+		s.splitWide(line, x+1)
+		prev.wide = true
+		line[x+1] = cell{link: prev.link, style: prev.style}
+		if s.curX == x+1 {
+			s.curX++
+		}
+	}
+	return true
+}
+
+// splitWide blanks the other half of a wide character about to be
+// partially overwritten at column x.
+func (s *screen) splitWide(line []cell, x int) {
+	blank := cell{ch: " ", style: style{bg: line[x].bg}}
+	if line[x].wide && x+1 < len(line) {
+		line[x+1] = blank
+	} else if line[x].ch == "" && x > 0 {
+		line[x-1] = blank
+	}
+}
+
+// clusterWidth returns the number of cells a grapheme cluster occupies:
+// 2 for East Asian wide and fullwidth characters and emoji presentation,
+// 0 for lone combining and other zero-width characters, and 1 otherwise.
+func clusterWidth(ch string) int {
+	if len(ch) == 1 {
+		return 1
+	}
+	return uniseg.StringWidth(ch)
+}
+
+// asciiStrings avoids allocating a string for every printable ASCII cell.
+var asciiStrings = func() (t [0x80]string) {
+	for i := range t {
+		t[i] = string(rune(i))
+	}
+	return t
+}()
+
+func runeString(r rune) string {
+	if r < 0x80 {
+		return asciiStrings[r]
+	}
+	return string(r)
+}
+
+// newline moves to the start of the next line, scrolling at the bottom.
+func (s *screen) newline() {
+	s.curX = 0
+	s.lineFeed()
+}
+
+func (s *screen) carriageReturn() {
+	s.curX = 0
+}
+
+func (s *screen) tab() {
+	next := (s.curX/8 + 1) * 8
+	if next >= s.cols {
+		next = s.cols - 1
+	}
+	if s.curX < s.cols {
+		s.curX = next
+	}
+}
+
+func blankLine(cols int) []cell {
+	line := make([]cell, cols)
+	for i := range line {
+		line[i] = cell{ch: " ", style: defaultStyle}
+	}
+	return line
+}
+
+// blank returns an erased cell. Erased cells take the current background
+// color (back color erase), as terminfo's xterm-256color entry promises.
+func (s *screen) blank() cell {
+	return cell{ch: " ", style: style{bg: s.pen.bg}}
+}
+
+func (s *screen) clearCells(row, from, to int) {
+	blank := s.blank()
+	for x := from; x < to; x++ {
+		s.cells[row][x] = blank
+	}
+}
+
+func (s *screen) cursor() cursorState {
+	return cursorState{
+		x: s.curX, y: s.curY,
+		pen:    s.pen,
+		origin: s.originMode,
+	}
+}
+
+func (s *screen) savedIndex() int {
+	if s.altActive {
+		return 1
+	}
+	return 0
+}
+
+// saveCursor implements DECSC. Each buffer keeps its own saved state.
+func (s *screen) saveCursor() {
+	s.saved[s.savedIndex()] = s.cursor()
+}
+
+// restoreCursor implements DECRC.
+func (s *screen) restoreCursor() {
+	c := s.saved[s.savedIndex()]
+	s.curX = min(c.x, s.cols-1)
+	s.curY = min(c.y, s.rows-1)
+	s.pen = c.pen
+	s.originMode = c.origin
+}
+
+// useAlternate switches between the primary and alternate buffers. The
+// alternate buffer is cleared when it is entered rather than when it is
+// left, so the last frame drawn by a full-screen program stays available
+// for capture after the program exits.
+func (s *screen) useAlternate(alt, clear bool) {
+	if alt == s.altActive {
+		return
+	}
+	s.altActive = alt
+	if alt {
+		s.cells = s.alternate
+		if clear {
+			for y := range s.cells {
+				s.clearCells(y, 0, s.cols)
+			}
+		}
+	} else {
+		s.cells = s.primary
+	}
+}
+
+// syncTimeout is how long a synchronized update may hold back the screen.
+const syncTimeout = time.Second
+
+// synchronize begins or ends a synchronized update. Snapshots taken during
+// one show the screen as it was before, so that a frame is never captured
+// half drawn.
+func (s *screen) synchronize(on bool) {
+	switch {
+	case !on:
+		s.frozen = nil
+	case s.frozen == nil:
+		f := *s
+		f.primary = cloneGrid(s.primary)
+		f.alternate = cloneGrid(s.alternate)
+		f.cells = f.primary
+		if f.altActive {
+			f.cells = f.alternate
+		}
+		// Lines in the scrollback only change when recycled, which
+		// pushScrollback avoids during the update.
+		f.scrollback = slices.Clip(s.scrollback)
+		f.replies = nil
+		s.frozen, s.frozenAt = &f, time.Now()
+	}
+}
+
+// visible returns the screen as it is to be seen: as it was before a
+// synchronized update in progress, unless the program has been at it for
+// so long that it has probably stopped without ending it.
+func (s *screen) visible() *screen {
+	if s.frozen != nil && time.Since(s.frozenAt) < syncTimeout {
+		return s.frozen
+	}
+	return s
+}
+
+func cloneGrid(grid [][]cell) [][]cell {
+	out := make([][]cell, len(grid))
+	for i, line := range grid {
+		out[i] = slices.Clone(line)
+	}
+	return out
+}
+
+func (s *screen) reset() {
+	old := *s
+	*s = *newScreen(s.cols, s.rows, s.theme)
+	s.replies = old.replies
+	s.scrollback, s.scrollbackLimit = old.scrollback, old.scrollbackLimit
+}
+
+// reply answers a query from the program. Without a program to answer,
+// as when reading from a pipe, it does nothing.
+func (s *screen) reply(answer string) {
+	if s.replies != nil {
+		io.WriteString(s.replies, answer)
+	}
+}
+
+// moveTo places the cursor at a zero-based position, clamped to the grid.
+func (s *screen) moveTo(x, y int) {
+	s.curX = min(max(x, 0), s.cols-1)
+	s.curY = min(max(y, 0), s.rows-1)
+}
+
+// feed runs terminal output through the parser and applies it to the screen.
+func (s *screen) feed(data []byte) {
+	s.parser.advance(s, data)
+}
+
+func (s *screen) print(r rune) {
+	s.write(r)
+}
+
+func (s *screen) execute(b byte) {
+	switch b {
+	case '\b':
+		if s.curX >= s.cols {
+			s.curX = s.cols - 1
+		}
+		if s.curX > 0 {
+			s.curX--
+		}
+	case '\t':
+		s.tab()
+	case '\n', '\v', '\f':
+		s.lineFeed()
+	case '\r':
+		s.carriageReturn()
+	}
+}
+
+func (s *screen) escDispatch(intermediates string, final byte) {
+	if intermediates != "" {
+		// Character set designations (ESC ( B etc.) are not emulated.
+		return
+	}
+	switch final {
+	case 'c': // RIS
+		s.reset()
+	case '7': // DECSC
+		s.saveCursor()
+	case '8': // DECRC
+		s.restoreCursor()
+	case 'D': // IND
+		s.lineFeed()
+	case 'E': // NEL
+		s.newline()
+	case 'M': // RI
+		s.reverseIndex()
+	}
+}
+
+func (s *screen) csiDispatch(params [][]int, intermediates string, final byte) {
+	switch intermediates {
+	case "":
+	case "?":
+		switch final {
+		case 'h': // DECSET
+			s.setPrivateModes(params, true)
+		case 'l': // DECRST
+			s.setPrivateModes(params, false)
+		case 'n': // DECXCPR
+			s.deviceStatus(params, true)
+		}
+		return
+	case ">":
+		switch final {
+		case 'c': // DA2
+			s.secondaryDeviceAttributes(params)
+		case 'q': // XTVERSION
+			s.terminalVersion(params)
+		}
+		return
+	case "$", "?$":
+		if final == 'p' { // DECRQM
+			s.reportMode(params, intermediates == "?$")
+		}
+		return
+	case " ":
+		if final == 'q' { // DECSCUSR
+			s.cursorShape = cursorShapeFor(param(params, 0, 0))
+		}
+		return
+	default:
+		return
+	}
+
+	switch final {
+	case 'm': // SGR
+		s.setSGR(params)
+	case 'n': // DSR
+		s.deviceStatus(params, false)
+	case 'c': // DA1
+		s.primaryDeviceAttributes(params)
+	case 'H', 'f': // CUP
+		s.setCursor(param(params, 1, 1)-1, param(params, 0, 1)-1)
+	case 'A': // CUU
+		s.cursorUp(param(params, 0, 1))
+	case 'B', 'e': // CUD, VPR
+		s.cursorDown(param(params, 0, 1))
+	case 'C', 'a': // CUF, HPR
+		s.moveTo(s.curX+param(params, 0, 1), s.curY)
+	case 'D': // CUB
+		s.moveTo(s.curX-param(params, 0, 1), s.curY)
+	case 'E': // CNL
+		s.cursorDown(param(params, 0, 1))
+		s.curX = 0
+	case 'F': // CPL
+		s.cursorUp(param(params, 0, 1))
+		s.curX = 0
+	case 'G', '`': // CHA, HPA
+		s.moveTo(param(params, 0, 1)-1, s.curY)
+	case 'd': // VPA
+		s.setCursor(s.curX, param(params, 0, 1)-1)
+	case 'r': // DECSTBM
+		s.setMargins(param(params, 0, 1), param(params, 1, s.rows))
+	case 'L': // IL
+		s.insertLines(param(params, 0, 1))
+	case 'M': // DL
+		s.deleteLines(param(params, 0, 1))
+	case '@': // ICH
+		s.insertChars(param(params, 0, 1))
+	case 'P': // DCH
+		s.deleteChars(param(params, 0, 1))
+	case 'X': // ECH
+		s.eraseChars(param(params, 0, 1))
+	case 'S': // SU
+		s.scrollUp(s.top, s.bottom, param(params, 0, 1), true)
+	case 'T': // SD
+		if len(params) <= 1 { // Five parameters is xterm mouse highlight tracking.
+			s.scrollDown(s.top, s.bottom, param(params, 0, 1))
+		}
+	case 'J': // ED
+		s.eraseDisplay(param(params, 0, 0))
+	case 'K': // EL
+		s.eraseLine(param(params, 0, 0))
+	case 's': // SCOSC
+		if len(params) == 0 {
+			s.saveCursor()
+		}
+	case 'u': // SCORC
+		if len(params) == 0 {
+			s.restoreCursor()
+		}
+	}
+}
+
+func (s *screen) setPrivateModes(params [][]int, on bool) {
+	for _, mode := range params {
+		switch mode[0] {
+		case 1: // DECCKM
+			s.appCursorKeys = on
+		case 25: // DECTCEM
+			s.cursorHidden = !on
+		case 2026: // Synchronized output
+			s.synchronize(on)
+		case 6: // DECOM
+			s.originMode = on
+			s.setCursor(0, 0)
+		case 47: // Alternate screen buffer
+			s.useAlternate(on, false)
+		case 1047: // Alternate screen buffer, cleared
+			s.useAlternate(on, true)
+		case 1049: // Alternate screen buffer with saved cursor
+			if on {
+				s.saveCursor()
+				s.useAlternate(true, true)
+			} else {
+				s.useAlternate(false, false)
+				s.restoreCursor()
+			}
+		}
+	}
+}
+
+func (s *screen) dcsHook(params [][]int, intermediates string, final byte) {}
+
+func (s *screen) dcsPut(b byte) {}
+
+func (s *screen) dcsUnhook() {}
+
+func (s *screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0: // Cursor to end of screen
+		s.eraseLine(0)
+		for y := s.curY + 1; y < s.rows; y++ {
+			s.clearCells(y, 0, s.cols)
+		}
+	case 1: // Start of screen to cursor
+		for y := 0; y < s.curY; y++ {
+			s.clearCells(y, 0, s.cols)
+		}
+		s.eraseLine(1)
+	case 2: // Entire screen
+		for y := 0; y < s.rows; y++ {
+			s.clearCells(y, 0, s.cols)
+		}
+	case 3: // Scrollback, as in xterm
+		s.scrollback = nil
+	}
+}
+
+func (s *screen) eraseLine(mode int) {
+	x := min(s.curX, s.cols-1)
+	switch mode {
+	case 0: // Cursor to end of line
+		s.eraseCells(s.curY, x, s.cols)
+	case 1: // Start of line to cursor
+		s.eraseCells(s.curY, 0, x+1)
+	case 2: // Entire line
+		s.clearCells(s.curY, 0, s.cols)
+	}
+}
+
+// param returns the i-th parameter, or def if it is missing or zero.
+func param(params [][]int, i, def int) int {
+	if i < len(params) && params[i][0] != 0 {
+		return params[i][0]
+	}
+	return def
+}
+
+// Write implements io.Writer so output can be streamed into the screen.
+func (s *screen) Write(data []byte) (int, error) {
+	s.feed(data)
+	return len(data), nil
+}
+
+// onlcr passes output on to w with line feeds turned into CR LF, as a PTY
+// does for programs unless they turn ONLCR off. Piped input has no PTY to
+// do it.
+type onlcr struct {
+	w io.Writer
+}
+
+func (o onlcr) Write(data []byte) (int, error) {
+	if _, err := o.w.Write(bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,217 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	keyInterval  = 50 * time.Millisecond // between keystrokes
+	pollInterval = 50 * time.Millisecond // between checks of the screen
+)
+
+// scriptStep is one step of a keystroke script: text or a named key to
+// type, a pause, or a wait for the screen to match.
+type scriptStep struct {
+	text  string
+	key   string // lowercase key name
+	pause time.Duration
+	wait  *regexp.Regexp
+}
+
+// parseScript parses a keystroke script. Steps are separated by spaces or
+// newlines:
+//
+//	Enter, Tab, Up, F5, ...  a named key, case-insensitive
+//	ctrl-x, alt-x            a key with a modifier
+//	j                        a single character, typed as is
+//	"some text"              text, with Go escapes
+//	sleep 500ms              a pause
+//	wait /regex/             wait until the screen matches
+//	# comment                ignored to the end of the line
+func parseScript(src string) ([]scriptStep, error) {
+	var steps []scriptStep
+	for {
+		src = strings.TrimLeftFunc(src, unicode.IsSpace)
+		if src == "" {
+			return steps, nil
+		}
+		switch {
+		case src[0] == '#':
+			_, src, _ = strings.Cut(src, "\n")
+		case src[0] == '"':
+			text, rest, err := scriptString(src)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, scriptStep{text: text})
+			src = rest
+		default:
+			word, rest := scriptWord(src)
+			src = rest
+			switch strings.ToLower(word) {
+			case "sleep":
+				arg, rest := scriptWord(strings.TrimLeftFunc(src, unicode.IsSpace))
+				src = rest
+				d, err := time.ParseDuration(arg)
+				if err != nil || d < 0 {
+					return nil, fmt.Errorf("sleep: invalid duration %q", arg)
+				}
+				steps = append(steps, scriptStep{pause: d})
+			case "wait":
+				re, rest, err := scriptRegexp(strings.TrimLeftFunc(src, unicode.IsSpace))
+				if err != nil {
+					return nil, err
+				}
+				steps = append(steps, scriptStep{wait: re})
+				src = rest
+			default:
+				if utf8.RuneCountInString(word) == 1 {
+					steps = append(steps, scriptStep{text: word})
+					continue
+				}
+				key := strings.ToLower(word)
+				if _, ok := keySequence(key, false); !ok {
+					return nil, fmt.Errorf("unknown key %q (quote text to type it)", word)
+				}
+				steps = append(steps, scriptStep{key: key})
+			}
+		}
+	}
+}
+
+// scriptWord splits off the word at the start of src.
+func scriptWord(src string) (word, rest string) {
+	end := strings.IndexFunc(src, unicode.IsSpace)
+	if end < 0 {
+		return src, ""
+	}
+	return src[:end], src[end:]
+}
+
+// scriptString splits off the quoted string at the start of src.
+func scriptString(src string) (text, rest string, err error) {
+	for i := 1; i < len(src); i++ {
+		switch src[i] {
+		case '\\':
+			i++
+		case '"':
+			text, err := strconv.Unquote(src[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", src[:i+1])
+			}
+			return text, src[i+1:], nil
+		case '\n':
+			i = len(src)
+		}
+	}
+	line, _, _ := strings.Cut(src, "\n")
+	return "", "", fmt.Errorf("unterminated string %s", line)
+}
+
+// scriptRegexp splits off the /regex/ at the start of src. A slash in the
+// regex is written \/.
+func scriptRegexp(src string) (*regexp.Regexp, string, error) {
+	if !strings.HasPrefix(src, "/") {
+		word, _ := scriptWord(src)
+		return nil, "", fmt.Errorf("wait: want /regex/, got %q", word)
+	}
+	var expr strings.Builder
+	for i := 1; i < len(src); i++ {
+		switch {
+		case src[i] == '/':
+			re, err := regexp.Compile(expr.String())
+			if err != nil {
+				return nil, "", fmt.Errorf("wait: %w", err)
+			}
+			return re, src[i+1:], nil
+		case src[i] == '\\' && i+1 < len(src) && src[i+1] == '/':
+			expr.WriteByte('/')
+			i++
+		case src[i] == '\n':
+			i = len(src)
+		default:
+			expr.WriteByte(src[i])
+		}
+	}
+	line, _, _ := strings.Cut(src, "\n")
+	return nil, "", fmt.Errorf("wait: unterminated regex %s", line)
+}
+
+// namedKeys are the sequences of keys sent as is, whatever the modes.
+var namedKeys = map[string]string{
+	"enter":     "\r",
+	"return":    "\r",
+	"tab":       "\t",
+	"backtab":   "\x1b[Z",
+	"shift-tab": "\x1b[Z",
+	"esc":       "\x1b",
+	"escape":    "\x1b",
+	"space":     " ",
+	"backspace": "\x7f",
+	"insert":    "\x1b[2~",
+	"delete":    "\x1b[3~",
+	"pageup":    "\x1b[5~",
+	"pagedown":  "\x1b[6~",
+	"f1":        "\x1bOP",
+	"f2":        "\x1bOQ",
+	"f3":        "\x1bOR",
+	"f4":        "\x1bOS",
+	"f5":        "\x1b[15~",
+	"f6":        "\x1b[17~",
+	"f7":        "\x1b[18~",
+	"f8":        "\x1b[19~",
+	"f9":        "\x1b[20~",
+	"f10":       "\x1b[21~",
+	"f11":       "\x1b[23~",
+	"f12":       "\x1b[24~",
+}
+
+// cursorKeys are the final bytes of the keys that DECCKM switches between
+// CSI and SS3 sequences.
+var cursorKeys = map[string]byte{
+	"up":    'A',
+	"down":  'B',
+	"right": 'C',
+	"left":  'D',
+	"home":  'H',
+	"end":   'F',
+}
+
+// keySequence returns the bytes a terminal sends for a lowercase key name,
+// with application cursor keys (DECCKM) on or off.
+func keySequence(name string, appCursor bool) (string, bool) {
+	if seq, ok := namedKeys[name]; ok {
+		return seq, true
+	}
+	if final, ok := cursorKeys[name]; ok {
+		if appCursor {
+			return "\x1bO" + string(final), true
+		}
+		return "\x1b[" + string(final), true
+	}
+	if key, ok := strings.CutPrefix(name, "alt-"); ok {
+		if utf8.RuneCountInString(key) == 1 {
+			return "\x1b" + key, true
+		}
+		seq, ok := keySequence(key, appCursor)
+		return "\x1b" + seq, ok
+	}
+	if key, ok := strings.CutPrefix(name, "ctrl-"); ok {
+		if key == "space" {
+			return "\x00", true
+		}
+		if len(key) == 1 && key[0] >= '?' && key[0] <= '~' {
+			if key[0] == '?' {
+				return "\x7f", true
+			}
+			return string(rune(key[0] & 0x1f)), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,132 @@
+package tui
+
+// underlineStyle is the kitty/VTE underline style selected with SGR 4:n.
+type underlineStyle uint8
+
+const (
+	underlineNone underlineStyle = iota
+	underlineSingle
+	underlineDouble
+	underlineCurly
+	underlineDotted
+	underlineDashed
+)
+
+// setSGR applies Select Graphic Rendition parameters to the pen.
+func (s *screen) setSGR(params [][]int) {
+	if len(params) == 0 {
+		params = [][]int{{0}}
+	}
+
+	for i := 0; i < len(params); i++ {
+		p, sub := params[i][0], params[i][1:]
+		switch {
+		case p == 0:
+			s.pen = defaultStyle
+		case p == 1:
+			s.pen.bold = true
+		case p == 2:
+			s.pen.dim = true
+		case p == 3:
+			s.pen.italic = true
+		case p == 4:
+			s.pen.underline = underlineSingle
+			if len(sub) > 0 && sub[0] <= int(underlineDashed) {
+				s.pen.underline = underlineStyle(sub[0])
+			}
+		case p == 5, p == 6:
+			s.pen.blink = true
+		case p == 7:
+			s.pen.reverse = true
+		case p == 8:
+			s.pen.invisible = true
+		case p == 9:
+			s.pen.strike = true
+		case p == 21:
+			s.pen.underline = underlineDouble
+		case p == 22:
+			s.pen.bold = false
+			s.pen.dim = false
+		case p == 23:
+			s.pen.italic = false
+		case p == 24:
+			s.pen.underline = underlineNone
+		case p == 25:
+			s.pen.blink = false
+		case p == 27:
+			s.pen.reverse = false
+		case p == 28:
+			s.pen.invisible = false
+		case p == 29:
+			s.pen.strike = false
+		case p >= 30 && p <= 37:
+			s.pen.fg = indexedColor(p - 30)
+		case p == 38:
+			if c, n := extendedColor(params[i:]); c != colorDefault {
+				s.pen.fg = c
+				i += n
+			}
+		case p == 39:
+			s.pen.fg = colorDefault
+		case p >= 40 && p <= 47:
+			s.pen.bg = indexedColor(p - 40)
+		case p == 48:
+			if c, n := extendedColor(params[i:]); c != colorDefault {
+				s.pen.bg = c
+				i += n
+			}
+		case p == 49:
+			s.pen.bg = colorDefault
+		case p == 53:
+			s.pen.overline = true
+		case p == 55:
+			s.pen.overline = false
+		case p == 58:
+			if c, n := extendedColor(params[i:]); c != colorDefault {
+				s.pen.ulColor = c
+				i += n
+			}
+		case p == 59:
+			s.pen.ulColor = colorDefault
+		case p >= 90 && p <= 97:
+			s.pen.fg = indexedColor(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			s.pen.bg = indexedColor(p - 100 + 8)
+		}
+	}
+}
+
+// extendedColor parses the color following SGR 38, 48 or 58 in params[0].
+// Both the colon form ("38:5:n", "38:2::r:g:b", "38:2:r:g:b") and the
+// legacy semicolon form ("38;5;n", "38;2;r;g;b") are accepted. It returns
+// the color and the number of extra parameter groups consumed, or
+// colorDefault if the parameters are malformed.
+func extendedColor(params [][]int) (color, int) {
+	if sub := params[0][1:]; len(sub) > 0 {
+		switch {
+		case sub[0] == 5 && len(sub) >= 2:
+			return indexedColor(sub[1]), 0
+		case sub[0] == 2 && len(sub) >= 5:
+			// The first value is the color space identifier.
+			return rgbColor(sub[2], sub[3], sub[4]), 0
+		case sub[0] == 2 && len(sub) == 4:
+			return rgbColor(sub[1], sub[2], sub[3]), 0
+		}
+		return colorDefault, 0
+	}
+
+	if len(params) < 2 {
+		return colorDefault, 0
+	}
+	switch params[1][0] {
+	case 5:
+		if len(params) >= 3 {
+			return indexedColor(params[2][0]), 2
+		}
+	case 2:
+		if len(params) >= 5 {
+			return rgbColor(params[2][0], params[3][0], params[4][0]), 4
+		}
+	}
+	return colorDefault, 0
+}
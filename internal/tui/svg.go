@@ -0,0 +1,354 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// sanitizeFontFamily removes characters that could enable SVG attribute injection
+func sanitizeFontFamily(font string) string {
+	// Only allow alphanumeric, spaces, hyphens, and commas (for font stacks)
+	var result strings.Builder
+	for _, r := range font {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			r == ' ' || r == '-' || r == ',' || r == '_' {
+			result.WriteRune(r)
+		}
+	}
+	if result.Len() == 0 {
+		return "monospace"
+	}
+	return result.String()
+}
+
+// renderOptions controls how a frame is rendered.
+type renderOptions struct {
+	fontSize   int
+	fontFamily string
+	window     windowStyle
+	cursor     cursorShape
+	title      string   // window title when the program did not set one
+	font       *svgFont // font to embed in SVGs, if any
+}
+
+func (f *frame) toSVG(opts renderOptions) string {
+	return toAnimatedSVG([]animFrame{{frame: f}}, opts)
+}
+
+// toAnimatedSVG renders frames shown one after the other, in a loop, by
+// CSS animations. The window and its size are those of the last frame; a
+// single frame renders as a still image.
+func toAnimatedSVG(frames []animFrame, opts renderOptions) string {
+	f := frames[len(frames)-1].frame
+	fontSize := opts.fontSize
+	charWidth := float64(fontSize) * 0.6
+	if opts.font != nil {
+		charWidth = float64(fontSize) * opts.font.advance
+	}
+	lineHeight := float64(fontSize) * 1.2
+	padding := 20.0
+	p := &f.palette
+
+	termWidth := float64(f.cols)*charWidth + padding*2
+	termHeight := float64(f.rows)*lineHeight + padding*2
+	chrome := newChrome(opts.window, termWidth, termHeight, fontSize)
+	width, height := chrome.size()
+
+	// Sanitize font-family to prevent SVG attribute injection
+	safeFontFamily := sanitizeFontFamily(opts.fontFamily)
+
+	var buf bytes.Buffer
+	xlinkNS := ""
+	if slices.ContainsFunc(frames, func(a animFrame) bool { return a.hasLinks() }) {
+		xlinkNS = ` xmlns:xlink="http://www.w3.org/1999/xlink"`
+	}
+	buf.WriteString(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg"%s viewBox="0 0 %d %d" width="%d" height="%d">
+`, xlinkNS, width, height, width, height))
+	title := f.title
+	if title == "" {
+		title = opts.title
+	}
+	if slices.ContainsFunc(frames, func(a animFrame) bool { return a.hasBlink() }) {
+		buf.WriteString(`<style>.blink{animation:blink 1s steps(1) infinite}@keyframes blink{50%{opacity:0}}</style>
+`)
+	}
+	if len(frames) > 1 {
+		writeFrameAnimations(&buf, frames)
+	}
+	if opts.font != nil {
+		used := f.usedRunes(title)
+		for _, a := range frames[:len(frames)-1] {
+			for i, runes := range a.usedRunes("") {
+				maps.Copy(used[i], runes)
+			}
+		}
+		buf.WriteString(fmt.Sprintf("<style>%s</style>\n", opts.font.css(used)))
+		safeFontFamily = embeddedFamily + ", " + safeFontFamily
+	}
+	if chrome.style == windowNone {
+		buf.WriteString(fmt.Sprintf(`<rect width="100%%" height="100%%" fill="%s"/>
+`, p.bg))
+	} else {
+		chrome.writeOpen(&buf, title, safeFontFamily, p)
+	}
+	buf.WriteString(fmt.Sprintf(`<g font-family="%s" font-size="%dpx">
+`, safeFontFamily, fontSize))
+
+	if len(frames) == 1 {
+		f.writeGrid(&buf, opts, padding, charWidth, lineHeight)
+	} else {
+		for i, a := range frames {
+			buf.WriteString(fmt.Sprintf(`<g class="frame frame-%d">
+`, i))
+			if a.palette.bg != p.bg {
+				// The program changed the background since.
+				buf.WriteString(fmt.Sprintf(`<rect width="%.1f" height="%.1f" fill="%s"/>
+`, termWidth, termHeight, a.palette.bg))
+			}
+			a.writeGrid(&buf, opts, padding, charWidth, lineHeight)
+			buf.WriteString("</g>\n")
+		}
+	}
+
+	buf.WriteString("</g>\n")
+	if chrome.style != windowNone {
+		chrome.writeClose(&buf)
+	}
+	buf.WriteString("</svg>\n")
+	return buf.String()
+}
+
+// writeGrid writes the cells of the frame, and the cursor if it is drawn.
+func (f *frame) writeGrid(buf *bytes.Buffer, opts renderOptions, padding, charWidth, lineHeight float64) {
+	p := &f.palette
+	fontSize := opts.fontSize
+
+	for row := 0; row < f.rows; row++ {
+		y := padding + float64(row+1)*lineHeight - lineHeight*0.2
+		top := y - lineHeight + lineHeight*0.2
+
+		// Group consecutive characters with same style
+		col := 0
+		for col < f.cols {
+			c := f.cells[row][col]
+			if c.isBlank() {
+				col++
+				continue
+			}
+
+			startCol := col
+			var text strings.Builder
+			if c.wide {
+				// Wide glyphs get their own run so that the text after them
+				// stays on the grid whatever width the font gives them.
+				text.WriteString(c.ch)
+				col = min(col+2, f.cols)
+			} else {
+				// Find run of same-styled characters
+				for col < f.cols {
+					next := f.cells[row][col]
+					if next.wide || next.style != c.style || next.link != c.link {
+						break
+					}
+					if next.ch == "" {
+						// Orphaned half of a wide character.
+						text.WriteRune(' ')
+					} else {
+						text.WriteString(next.ch)
+					}
+					col++
+				}
+			}
+
+			x := padding + float64(startCol)*charWidth
+			runWidth := float64(col-startCol) * charWidth
+			textStr := strings.TrimRight(text.String(), " ")
+			fg, bg := c.colors(p)
+
+			href := safeLink(c.link)
+			if href != "" {
+				buf.WriteString(fmt.Sprintf(`<a href="%[1]s" xlink:href="%[1]s" target="_blank">
+`, html.EscapeString(href)))
+			}
+
+			// Background rect (even if the run is all spaces).
+			if bg != "" {
+				buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`,
+					x, top, runWidth, lineHeight, bg))
+			}
+
+			if !c.invisible {
+				if textStr != "" {
+					buf.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" fill="%s"%s xml:space="preserve">%s</text>
+`,
+						x, y, fg, textAttrs(c.style), html.EscapeString(textStr)))
+				}
+				writeDecorations(buf, p, c.style, fg, x, runWidth, y, top, float64(fontSize), charWidth)
+			}
+
+			if href != "" {
+				buf.WriteString("</a>\n")
+			}
+		}
+	}
+
+	if opts.cursor != cursorNone && f.cursor.visible {
+		f.writeCursor(buf, opts.cursor, padding, charWidth, lineHeight, float64(fontSize))
+	}
+}
+
+// writeCursor draws the cursor over the grid. A block cursor shows the
+// character under it in the background color, like a terminal does.
+func (f *frame) writeCursor(buf *bytes.Buffer, shape cursorShape, padding, charWidth, lineHeight, fontSize float64) {
+	if shape == cursorAuto {
+		shape = f.cursor.shape
+	}
+	col, row := f.cursor.x, f.cursor.y
+	c := f.cells[row][col]
+	if c.ch == "" && col > 0 {
+		// On the right half of a wide character.
+		col--
+		c = f.cells[row][col]
+	}
+	width := charWidth
+	if c.wide {
+		width *= 2
+	}
+
+	p := &f.palette
+	x := padding + float64(col)*charWidth
+	top := padding + float64(row)*lineHeight
+	thickness := max(1, fontSize/7)
+	switch shape {
+	case cursorBar:
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`, x, top, thickness, lineHeight, p.cursor))
+	case cursorUnderline:
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`, x, top+lineHeight-thickness, width, thickness, p.cursor))
+	default:
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`, x, top, width, lineHeight, p.cursor))
+		if c.ch != "" && c.ch != " " && !c.invisible {
+			buf.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" fill="%s"%s xml:space="preserve">%s</text>
+`, x, top+lineHeight*0.8, p.bg, textAttrs(c.style), html.EscapeString(c.ch)))
+		}
+	}
+}
+
+func (f *frame) hasBlink() bool {
+	for _, line := range f.cells {
+		for _, c := range line {
+			if c.blink && !c.isBlank() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (f *frame) hasLinks() bool {
+	for _, line := range f.cells {
+		for _, c := range line {
+			if c.link != "" && safeLink(c.link) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isBlank reports whether the cell paints nothing over the default background.
+func (c cell) isBlank() bool {
+	return (c.ch == " " || c.ch == "") && c.bg == colorDefault &&
+		!c.reverse && c.underline == underlineNone && !c.strike && !c.overline
+}
+
+// colors resolves the foreground and background to paint against the
+// palette, with reverse video applied. An empty background means the default
+// one, which needs no painting.
+func (st style) colors(p *palette) (fg, bg string) {
+	fg = p.hex(st.fg, p.fg)
+	if st.bg != colorDefault {
+		bg = p.hex(st.bg, p.bg)
+	}
+	if st.reverse {
+		return p.hex(st.bg, p.bg), fg
+	}
+	return fg, bg
+}
+
+// textAttrs returns the SVG attributes for the font attributes of st.
+func textAttrs(st style) string {
+	weight := "normal"
+	if st.bold {
+		weight = "bold"
+	}
+	attrs := fmt.Sprintf(` font-weight="%s"`, weight)
+	if st.italic {
+		attrs += ` font-style="italic"`
+	}
+	if st.dim {
+		attrs += ` opacity="0.5"`
+	}
+	if st.blink {
+		attrs += ` class="blink"`
+	}
+	return attrs
+}
+
+// writeDecorations draws underline, strikethrough and overline spanning
+// the whole run, including trailing spaces, like a terminal does.
+func writeDecorations(buf *bytes.Buffer, p *palette, st style, color string, x, width, baseline, top, fontSize, charWidth float64) {
+	thickness := max(1, fontSize/14)
+	line := func(y float64, stroke, extra string) {
+		buf.WriteString(fmt.Sprintf(`<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="%.1f"%s/>
+`,
+			x, y, x+width, y, stroke, thickness, extra))
+	}
+
+	if st.underline != underlineNone {
+		ulColor := p.hex(st.ulColor, color)
+		y := baseline + fontSize*0.12
+		switch st.underline {
+		case underlineSingle:
+			line(y, ulColor, "")
+		case underlineDouble:
+			line(y-thickness, ulColor, "")
+			line(y+thickness*1.5, ulColor, "")
+		case underlineCurly:
+			writeCurl(buf, ulColor, x, width, y, thickness, charWidth)
+		case underlineDotted:
+			line(y, ulColor, fmt.Sprintf(` stroke-dasharray="%.1f %.1f"`, thickness, thickness*2))
+		case underlineDashed:
+			line(y, ulColor, fmt.Sprintf(` stroke-dasharray="%.1f %.1f"`, charWidth*0.5, charWidth*0.25))
+		}
+	}
+	if st.strike {
+		line(baseline-fontSize*0.3, color, "")
+	}
+	if st.overline {
+		line(top+thickness/2, color, "")
+	}
+}
+
+// writeCurl draws a wavy underline with one period per cell, as used for
+// diagnostics squiggles.
+func writeCurl(buf *bytes.Buffer, color string, x, width, y, thickness, charWidth float64) {
+	half := charWidth / 2
+	amplitude := max(1.5, thickness*1.5)
+
+	var d strings.Builder
+	d.WriteString(fmt.Sprintf("M%.1f %.1fq%.1f %.1f %.1f 0", x, y, half/2, -amplitude*2, half))
+	for drawn := half; drawn < width-0.05; drawn += half {
+		d.WriteString(fmt.Sprintf("t%.1f 0", half))
+	}
+	buf.WriteString(fmt.Sprintf(`<path d="%s" fill="none" stroke="%s" stroke-width="%.1f"/>
+`,
+		d.String(), color, thickness))
+}
@@ -0,0 +1,157 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// span is a run of cells in a line sharing a style and link, as drawn by
+// the text-based formats.
+type span struct {
+	col   int // first column
+	width int // in cells
+	text  string
+	link  string
+	style
+}
+
+// spans splits the first n cells of a line into runs of the same style
+// and link. The right halves of wide characters add to the width but not
+// the text. Concealed (SGR 8) cells are blanks, as they are on screen.
+func spans(line []cell, n int) []span {
+	var out []span
+	for col := 0; col < n; col++ {
+		c := line[col]
+		text := c.ch
+		switch {
+		case c.invisible:
+			text = " "
+		case text == "" && (col == 0 || !line[col-1].wide):
+			// Orphaned half of a wide character.
+			text = " "
+		}
+		if last := len(out) - 1; last >= 0 && out[last].style == c.style && out[last].link == c.link {
+			out[last].width++
+			out[last].text += text
+			continue
+		}
+		out = append(out, span{col: col, width: 1, text: text, link: c.link, style: c.style})
+	}
+	return out
+}
+
+// usedWidth returns the number of cells in a line up to and including
+// the last one that paints something.
+func usedWidth(line []cell) int {
+	for col := len(line) - 1; col >= 0; col-- {
+		if !line[col].isBlank() || line[col].link != "" {
+			return col + 1
+		}
+	}
+	return 0
+}
+
+// lineText returns the text of a line without trailing spaces.
+func lineText(line []cell) string {
+	var b strings.Builder
+	for _, s := range spans(line, len(line)) {
+		b.WriteString(s.text)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
+
+// toText renders the frame as plain text, without trailing spaces or
+// trailing empty lines.
+func (f *frame) toText() string {
+	lines := make([]string, len(f.cells))
+	for i, line := range f.cells {
+		lines[i] = lineText(line)
+	}
+	text := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// toANSI renders the frame as text with the fewest SGR sequences that
+// reproduce its attributes, and OSC 8 for links. Each line starts from the
+// default style, so lines can be read on their own.
+func (f *frame) toANSI() string {
+	lines := make([]string, len(f.cells))
+	for i, line := range f.cells {
+		var b strings.Builder
+		pen, link := defaultStyle, ""
+		for _, s := range spans(line, usedWidth(line)) {
+			if s.link != link {
+				fmt.Fprintf(&b, "\x1b]8;;%s\x1b\\", s.link)
+				link = s.link
+			}
+			if s.style != pen {
+				b.WriteString(sgrSequence(s.style))
+				pen = s.style
+			}
+			b.WriteString(s.text)
+		}
+		if link != "" {
+			b.WriteString("\x1b]8;;\x1b\\")
+		}
+		if pen != defaultStyle {
+			b.WriteString("\x1b[0m")
+		}
+		lines[i] = b.String()
+	}
+	text := strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// sgrSequence returns the SGR sequence that sets st from any style.
+func sgrSequence(st style) string {
+	params := []string{"0"}
+	add := func(on bool, p string) {
+		if on {
+			params = append(params, p)
+		}
+	}
+	add(st.bold, "1")
+	add(st.dim, "2")
+	add(st.italic, "3")
+	switch st.underline {
+	case underlineNone:
+	case underlineSingle:
+		params = append(params, "4")
+	default:
+		params = append(params, "4:"+strconv.Itoa(int(st.underline)))
+	}
+	add(st.blink, "5")
+	add(st.reverse, "7")
+	add(st.invisible, "8")
+	add(st.strike, "9")
+	add(st.overline, "53")
+	add(st.fg != colorDefault, sgrColor(st.fg, 30))
+	add(st.bg != colorDefault, sgrColor(st.bg, 40))
+	add(st.ulColor != colorDefault, sgrColor(st.ulColor, 50))
+	return "\x1b[" + strings.Join(params, ";") + "m"
+}
+
+// sgrColor returns the SGR parameter for a color, where base is 30 for
+// the foreground, 40 for the background and 50 for the underline color.
+func sgrColor(c color, base int) string {
+	v := int(c &^ colorKindMask)
+	if c&colorKindMask == colorRGB {
+		return fmt.Sprintf("%d;2;%d;%d;%d", base+8, v>>16, v>>8&0xff, v&0xff)
+	}
+	switch {
+	case base == 50:
+		// Underline colors have no 16-color form.
+	case v < 8:
+		return strconv.Itoa(base + v)
+	case v < 16:
+		return strconv.Itoa(base + 60 + v - 8)
+	}
+	return fmt.Sprintf("%d;5;%d", base+8, v)
+}
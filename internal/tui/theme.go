@@ -0,0 +1,108 @@
+package tui
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// theme is a terminal color scheme: the default colors and the 16 ANSI
+// colors, as "#rrggbb".
+type theme struct {
+	name   string
+	fg     string
+	bg     string
+	cursor string
+	ansi   [16]string // black, red, green, yellow, blue, magenta, cyan, white, then the bright variants
+}
+
+const defaultThemeName = "one-dark"
+
+var themes = map[string]*theme{
+	"one-dark": {
+		fg: "#abb2bf", bg: "#282c34", cursor: "#528bff",
+		ansi: [16]string{
+			"#282c34", "#e06c75", "#98c379", "#e5c07b", "#61afef", "#c678dd", "#56b6c2", "#abb2bf",
+			"#5c6370", "#e06c75", "#98c379", "#e5c07b", "#61afef", "#c678dd", "#56b6c2", "#ffffff",
+		},
+	},
+	"one-light": {
+		fg: "#383a42", bg: "#fafafa", cursor: "#526fff",
+		ansi: [16]string{
+			"#383a42", "#e45649", "#50a14f", "#c18401", "#0184bc", "#a626a4", "#0997b3", "#fafafa",
+			"#4f525e", "#e06c75", "#98c379", "#e5c07b", "#61afef", "#c678dd", "#56b6c2", "#ffffff",
+		},
+	},
+	"solarized-dark": {
+		fg: "#839496", bg: "#002b36", cursor: "#93a1a1",
+		ansi: solarized,
+	},
+	"solarized-light": {
+		fg: "#657b83", bg: "#fdf6e3", cursor: "#586e75",
+		ansi: solarized,
+	},
+	"dracula": {
+		fg: "#f8f8f2", bg: "#282a36", cursor: "#f8f8f2",
+		ansi: [16]string{
+			"#21222c", "#ff5555", "#50fa7b", "#f1fa8c", "#bd93f9", "#ff79c6", "#8be9fd", "#f8f8f2",
+			"#6272a4", "#ff6e6e", "#69ff94", "#ffffa5", "#d6acff", "#ff92df", "#a4ffff", "#ffffff",
+		},
+	},
+	"nord": {
+		fg: "#d8dee9", bg: "#2e3440", cursor: "#d8dee9",
+		ansi: [16]string{
+			"#3b4252", "#bf616a", "#a3be8c", "#ebcb8b", "#81a1c1", "#b48ead", "#88c0d0", "#e5e9f0",
+			"#4c566a", "#bf616a", "#a3be8c", "#ebcb8b", "#81a1c1", "#b48ead", "#8fbcbb", "#eceff4",
+		},
+	},
+	"gruvbox-dark": {
+		fg: "#ebdbb2", bg: "#282828", cursor: "#ebdbb2",
+		ansi: [16]string{
+			"#282828", "#cc241d", "#98971a", "#d79921", "#458588", "#b16286", "#689d6a", "#a89984",
+			"#928374", "#fb4934", "#b8bb26", "#fabd2f", "#83a598", "#d3869b", "#8ec07c", "#ebdbb2",
+		},
+	},
+	"github-light": {
+		fg: "#24292f", bg: "#ffffff", cursor: "#0969da",
+		ansi: [16]string{
+			"#24292f", "#cf222e", "#116329", "#4d2d00", "#0969da", "#8250df", "#1b7c83", "#6e7781",
+			"#57606a", "#a40e26", "#1a7f37", "#633c01", "#218bff", "#a475f9", "#3192aa", "#8c959f",
+		},
+	},
+}
+
+// solarized is shared by the dark and light variants, which differ only
+// in their default colors.
+var solarized = [16]string{
+	"#073642", "#dc322f", "#859900", "#b58900", "#268bd2", "#d33682", "#2aa198", "#eee8d5",
+	"#002b36", "#cb4b16", "#586e75", "#657b83", "#839496", "#6c71c4", "#93a1a1", "#fdf6e3",
+}
+
+func init() {
+	for name, t := range themes {
+		t.name = name
+	}
+}
+
+// themeNames returns the names of the built-in themes, sorted.
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// findTheme returns the built-in theme called name, or loads the theme
+// file at that path.
+func findTheme(name string) (*theme, error) {
+	if t, ok := themes[name]; ok {
+		return t, nil
+	}
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("unknown theme %q (want a theme file or one of %s)", name, strings.Join(themeNames(), ", "))
+	}
+	return loadTheme(name)
+}
@@ -0,0 +1,341 @@
+package tui
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadTheme reads a color scheme exported by another terminal. The format
+// is chosen by extension: .itermcolors (iTerm2), .toml (Alacritty), .json
+// (Windows Terminal) and .yaml or .yml (Alacritty or base16).
+func loadTheme(path string) (*theme, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var t *theme
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".itermcolors":
+		t, err = parseITermColors(data)
+	case ".toml":
+		t, err = parseAlacrittyTOML(data)
+	case ".json":
+		t, err = parseWindowsTerminal(data)
+	case ".yaml", ".yml":
+		t, err = parseThemeYAML(data)
+	default:
+		return nil, fmt.Errorf("theme %s: unsupported format %q (want .itermcolors, .toml, .json, .yaml or .yml)", path, ext)
+	}
+	if err == nil {
+		err = t.validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("theme %s: %w", path, err)
+	}
+	if t.name == "" {
+		t.name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return t, nil
+}
+
+// validate normalizes the colors of an imported theme and fills in the
+// optional ones: bright colors default to their normal variant and the
+// cursor to the foreground. Colors end up in the SVG verbatim, so anything
+// that is not a plain hex color is rejected.
+func (t *theme) validate() error {
+	var err error
+	if t.fg, err = normalizeHex(t.fg, "foreground"); err != nil {
+		return err
+	}
+	if t.bg, err = normalizeHex(t.bg, "background"); err != nil {
+		return err
+	}
+	if t.cursor == "" {
+		t.cursor = t.fg
+	} else if t.cursor, err = normalizeHex(t.cursor, "cursor"); err != nil {
+		return err
+	}
+	for i := range t.ansi {
+		if i >= 8 && t.ansi[i] == "" {
+			t.ansi[i] = t.ansi[i-8]
+			continue
+		}
+		if t.ansi[i], err = normalizeHex(t.ansi[i], fmt.Sprintf("color %d", i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeHex converts "#rrggbb", "0xrrggbb", "rrggbb" or "#rgb" to
+// lowercase "#rrggbb".
+func normalizeHex(s, what string) (string, error) {
+	if s == "" {
+		return "", fmt.Errorf("missing %s color", what)
+	}
+	h := strings.TrimPrefix(strings.TrimPrefix(strings.TrimPrefix(s, "#"), "0x"), "0X")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return "", fmt.Errorf("invalid %s color %q", what, s)
+	}
+	if _, err := strconv.ParseUint(h, 16, 32); err != nil {
+		return "", fmt.Errorf("invalid %s color %q", what, s)
+	}
+	return "#" + strings.ToLower(h), nil
+}
+
+// parseITermColors reads an iTerm2 .itermcolors property list, a dict of
+// "Ansi 0 Color" ... "Ansi 15 Color", "Background Color" and so on, each
+// a dict of color components between 0 and 1.
+func parseITermColors(data []byte) (*theme, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("no color dictionary: %w", err)
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "dict" {
+			break
+		}
+	}
+	plist, err := readPlistDict(d)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &theme{}
+	get := func(key string) string {
+		c, ok := plist[key].(map[string]any)
+		if !ok {
+			return ""
+		}
+		component := func(name string) int {
+			v, _ := c[name+" Component"].(float64)
+			return int(math.Round(min(max(v, 0), 1) * 255))
+		}
+		return fmt.Sprintf("#%02x%02x%02x", component("Red"), component("Green"), component("Blue"))
+	}
+	t.fg = get("Foreground Color")
+	t.bg = get("Background Color")
+	t.cursor = get("Cursor Color")
+	for i := range t.ansi {
+		t.ansi[i] = get(fmt.Sprintf("Ansi %d Color", i))
+	}
+	return t, nil
+}
+
+// readPlistDict reads the contents of a plist <dict> whose start element
+// has been consumed. Reals and integers become float64, dicts become maps
+// and everything else its text.
+func readPlistDict(d *xml.Decoder) (map[string]any, error) {
+	dict := map[string]any{}
+	key := ""
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.EndElement:
+			return dict, nil
+		case xml.StartElement:
+			if tok.Name.Local == "dict" {
+				v, err := readPlistDict(d)
+				if err != nil {
+					return nil, err
+				}
+				dict[key] = v
+				continue
+			}
+			var text string
+			if err := d.DecodeElement(&text, &tok); err != nil {
+				return nil, err
+			}
+			switch tok.Name.Local {
+			case "key":
+				key = text
+			case "real", "integer":
+				f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q for %q", text, key)
+				}
+				dict[key] = f
+			default:
+				dict[key] = text
+			}
+		}
+	}
+}
+
+// alacrittyConfig is the colors section of an Alacritty configuration, in
+// either its TOML or its older YAML form.
+type alacrittyConfig struct {
+	Colors struct {
+		Primary struct {
+			Background string `toml:"background" yaml:"background"`
+			Foreground string `toml:"foreground" yaml:"foreground"`
+		} `toml:"primary" yaml:"primary"`
+		Cursor struct {
+			Cursor string `toml:"cursor" yaml:"cursor"`
+		} `toml:"cursor" yaml:"cursor"`
+		Normal alacrittyANSI `toml:"normal" yaml:"normal"`
+		Bright alacrittyANSI `toml:"bright" yaml:"bright"`
+	} `toml:"colors" yaml:"colors"`
+}
+
+type alacrittyANSI struct {
+	Black   string `toml:"black" yaml:"black"`
+	Red     string `toml:"red" yaml:"red"`
+	Green   string `toml:"green" yaml:"green"`
+	Yellow  string `toml:"yellow" yaml:"yellow"`
+	Blue    string `toml:"blue" yaml:"blue"`
+	Magenta string `toml:"magenta" yaml:"magenta"`
+	Cyan    string `toml:"cyan" yaml:"cyan"`
+	White   string `toml:"white" yaml:"white"`
+}
+
+func (a alacrittyANSI) colors() [8]string {
+	return [8]string{a.Black, a.Red, a.Green, a.Yellow, a.Blue, a.Magenta, a.Cyan, a.White}
+}
+
+func (c *alacrittyConfig) theme() *theme {
+	t := &theme{
+		fg: c.Colors.Primary.Foreground,
+		bg: c.Colors.Primary.Background,
+	}
+	// The cursor may also be "CellForeground" or "CellBackground", which
+	// have no fixed color.
+	if _, err := normalizeHex(c.Colors.Cursor.Cursor, "cursor"); err == nil {
+		t.cursor = c.Colors.Cursor.Cursor
+	}
+	normal, bright := c.Colors.Normal.colors(), c.Colors.Bright.colors()
+	copy(t.ansi[:8], normal[:])
+	copy(t.ansi[8:], bright[:])
+	return t
+}
+
+func parseAlacrittyTOML(data []byte) (*theme, error) {
+	var c alacrittyConfig
+	if _, err := toml.Decode(string(data), &c); err != nil {
+		return nil, err
+	}
+	return c.theme(), nil
+}
+
+// parseThemeYAML reads a base16 scheme, recognized by its base00 to base0F
+// colors, or else an Alacritty YAML configuration.
+func parseThemeYAML(data []byte) (*theme, error) {
+	var base16 struct {
+		Scheme  string            `yaml:"scheme"`
+		Name    string            `yaml:"name"`
+		Palette map[string]string `yaml:"palette"`
+		Base00  string            `yaml:"base00"`
+	}
+	if yaml.Unmarshal(data, &base16) == nil && (base16.Base00 != "" || base16.Palette != nil) {
+		palette := base16.Palette
+		if palette == nil {
+			if err := yaml.Unmarshal(data, &palette); err != nil {
+				return nil, err
+			}
+		}
+		t := parseBase16(palette)
+		t.name = cmp.Or(base16.Name, base16.Scheme)
+		return t, nil
+	}
+
+	var c alacrittyConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	if c.Colors.Primary.Background == "" {
+		return nil, errors.New("neither a base16 scheme nor an Alacritty configuration")
+	}
+	return c.theme(), nil
+}
+
+// parseBase16 maps a base16 palette to terminal colors the way
+// base16-shell does.
+func parseBase16(palette map[string]string) *theme {
+	base := func(n int) string {
+		// Keys are spelled base0A or base0a.
+		if c, ok := palette[fmt.Sprintf("base%02X", n)]; ok {
+			return c
+		}
+		return palette[fmt.Sprintf("base%02x", n)]
+	}
+	return &theme{
+		fg:     base(0x05),
+		bg:     base(0x00),
+		cursor: base(0x05),
+		ansi: [16]string{
+			base(0x00), base(0x08), base(0x0B), base(0x0A), base(0x0D), base(0x0E), base(0x0C), base(0x05),
+			base(0x03), base(0x08), base(0x0B), base(0x0A), base(0x0D), base(0x0E), base(0x0C), base(0x07),
+		},
+	}
+}
+
+// windowsTerminalScheme is a color scheme from Windows Terminal's
+// settings, where magenta is called purple.
+type windowsTerminalScheme struct {
+	Name         string `json:"name"`
+	Foreground   string `json:"foreground"`
+	Background   string `json:"background"`
+	CursorColor  string `json:"cursorColor"`
+	Black        string `json:"black"`
+	Red          string `json:"red"`
+	Green        string `json:"green"`
+	Yellow       string `json:"yellow"`
+	Blue         string `json:"blue"`
+	Purple       string `json:"purple"`
+	Cyan         string `json:"cyan"`
+	White        string `json:"white"`
+	BrightBlack  string `json:"brightBlack"`
+	BrightRed    string `json:"brightRed"`
+	BrightGreen  string `json:"brightGreen"`
+	BrightYellow string `json:"brightYellow"`
+	BrightBlue   string `json:"brightBlue"`
+	BrightPurple string `json:"brightPurple"`
+	BrightCyan   string `json:"brightCyan"`
+	BrightWhite  string `json:"brightWhite"`
+}
+
+// parseWindowsTerminal reads a single Windows Terminal scheme, or the
+// first entry of a "schemes" list.
+func parseWindowsTerminal(data []byte) (*theme, error) {
+	var doc struct {
+		windowsTerminalScheme
+		Schemes []windowsTerminalScheme `json:"schemes"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	s := doc.windowsTerminalScheme
+	if len(doc.Schemes) > 0 {
+		s = doc.Schemes[0]
+	}
+	return &theme{
+		name:   s.Name,
+		fg:     s.Foreground,
+		bg:     s.Background,
+		cursor: s.CursorColor,
+		ansi: [16]string{
+			s.Black, s.Red, s.Green, s.Yellow, s.Blue, s.Purple, s.Cyan, s.White,
+			s.BrightBlack, s.BrightRed, s.BrightGreen, s.BrightYellow, s.BrightBlue, s.BrightPurple, s.BrightCyan, s.BrightWhite,
+		},
+	}, nil
+}
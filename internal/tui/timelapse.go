@@ -0,0 +1,111 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseFrameTimes returns the moments, after the command starts, to take
+// time-lapse frames at: the list given with -frames, or count frames every
+// interval. It returns nil for a single capture.
+func parseFrameTimes(list string, every time.Duration, count int) ([]time.Duration, error) {
+	switch {
+	case list != "" && (every != 0 || count != 0):
+		return nil, errors.New("-frames cannot be used with -every and -count")
+	case list != "":
+		var times []time.Duration
+		for _, s := range strings.Split(list, ",") {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("invalid frame time %q", s)
+			}
+			times = append(times, d)
+		}
+		slices.Sort(times)
+		return times, nil
+	case every == 0 && count == 0:
+		return nil, nil
+	case every <= 0 || count <= 0:
+		return nil, errors.New("-every and -count need each other, with positive values")
+	}
+	times := make([]time.Duration, count)
+	for i := range times {
+		times[i] = time.Duration(i+1) * every
+	}
+	return times, nil
+}
+
+// pathVerb matches the printf verbs, and %%, that a path may hold.
+var pathVerb = regexp.MustCompile(`%[-+ #0]*[0-9]*[a-zA-Z%]?`)
+
+// numberedPath returns the output path of frame i, counting from 1, of n:
+// path formatted with i if it holds exactly one integer verb like %03d, or
+// else path with -i before the extension, zero-padded so that the files
+// sort in order.
+func numberedPath(path string, i, n int) string {
+	ints, others := 0, 0
+	for _, verb := range pathVerb.FindAllString(path, -1) {
+		switch {
+		case verb == "%%":
+		case strings.ContainsAny(verb[len(verb)-1:], "dboxX"):
+			ints++
+		default:
+			others++
+		}
+	}
+	if ints == 1 && others == 0 {
+		return fmt.Sprintf(path, i)
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%0*d%s", strings.TrimSuffix(path, ext), len(strconv.Itoa(n)), i, ext)
+}
+
+// captureTimeline runs command in a pseudo-terminal sized to scr and takes
+// a frame with snapshot at each of times after it starts, while the
+// keystroke script, if any, plays. Frames due after the command exits are
+// all of its final screen. A *waitError from the script comes with the
+// frames all the same.
+func captureTimeline(command string, scr *screen, opts captureOptions, times []time.Duration, snapshot func(*screen) *frame) ([]*frame, error) {
+	s, err := startSession(command, scr, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer s.stop()
+	start := time.Now()
+
+	scriptDone := make(chan error, 1)
+	go func() {
+		scriptDone <- s.run(opts.script, opts.timeout)
+	}()
+
+	frames := make([]*frame, 0, len(times))
+	exited := false
+	for _, at := range times {
+		if !exited {
+			select {
+			case <-time.After(time.Until(start.Add(at))):
+			case <-s.done:
+				// Let the last of the output arrive, then take the rest at once.
+				time.Sleep(100 * time.Millisecond)
+				exited = true
+			}
+		}
+		s.mu.Lock()
+		frames = append(frames, snapshot(scr))
+		s.mu.Unlock()
+	}
+
+	select {
+	case err := <-scriptDone:
+		return frames, err
+	default:
+		// The script outlasted the frames.
+		return frames, nil
+	}
+}
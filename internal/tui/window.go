@@ -0,0 +1,144 @@
+package tui
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+	"unicode/utf8"
+)
+
+// windowStyle selects the window decoration drawn around the terminal.
+type windowStyle int
+
+const (
+	windowNone windowStyle = iota
+	windowMacOS
+	windowTab
+)
+
+func parseWindowStyle(name string) (windowStyle, error) {
+	switch name {
+	case "none", "":
+		return windowNone, nil
+	case "macos", "mac":
+		return windowMacOS, nil
+	case "tab":
+		return windowTab, nil
+	}
+	return 0, fmt.Errorf("invalid window %q (want none, macos or tab)", name)
+}
+
+// chrome lays out a window frame: a rounded window with a drop shadow and
+// a title bar, with the terminal drawn below the bar.
+type chrome struct {
+	style      windowStyle
+	termWidth  float64
+	termHeight float64
+	fontSize   int
+	margin     float64 // room around the window for the shadow
+	barHeight  float64
+}
+
+func newChrome(style windowStyle, termWidth, termHeight float64, fontSize int) chrome {
+	c := chrome{style: style, termWidth: termWidth, termHeight: termHeight, fontSize: fontSize}
+	if style != windowNone {
+		c.margin = 32
+		c.barHeight = float64(fontSize) * 2.4
+	}
+	return c
+}
+
+// size returns the dimensions of the whole image.
+func (c chrome) size() (int, int) {
+	return int(c.termWidth + c.margin*2), int(c.termHeight + c.barHeight + c.margin*2)
+}
+
+// writeOpen draws the window and title bar and opens the group that the
+// terminal content is drawn into.
+func (c chrome) writeOpen(buf *bytes.Buffer, title, fontFamily string, p *palette) {
+	winHeight := c.termHeight + c.barHeight
+	buf.WriteString(fmt.Sprintf(`<defs>
+<filter id="agentshot-shadow" x="-20%%" y="-20%%" width="140%%" height="140%%">
+<feGaussianBlur in="SourceAlpha" stdDeviation="10"/>
+<feOffset dy="8"/>
+<feComponentTransfer><feFuncA type="linear" slope="0.45"/></feComponentTransfer>
+<feMerge><feMergeNode/><feMergeNode in="SourceGraphic"/></feMerge>
+</filter>
+<clipPath id="agentshot-window"><rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="10"/></clipPath>
+</defs>
+`, c.margin, c.margin, c.termWidth, winHeight))
+	buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="10" fill="%s" filter="url(#agentshot-shadow)"/>
+`, c.margin, c.margin, c.termWidth, winHeight, p.bg))
+
+	barY := c.margin + c.barHeight/2
+	titleSize := float64(c.fontSize) * 0.9
+	buf.WriteString(`<g clip-path="url(#agentshot-window)">
+`)
+	switch c.style {
+	case windowMacOS:
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`, c.margin, c.margin, c.termWidth, c.barHeight, mixHex(p.bg, "#ffffff", 0.06)))
+		for i, color := range []string{"#ff5f57", "#febc2e", "#28c840"} {
+			buf.WriteString(fmt.Sprintf(`<circle cx="%.1f" cy="%.1f" r="6" fill="%s"/>
+`, c.margin+20+float64(i)*20, barY, color))
+		}
+		// Leave room for the buttons on both sides to keep the title centered.
+		maxWidth := c.termWidth - 2*90
+		buf.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" fill="%s" font-family="%s" font-size="%.1fpx" text-anchor="middle" dominant-baseline="middle">%s</text>
+`, c.margin+c.termWidth/2, barY, p.fg, fontFamily, titleSize, html.EscapeString(truncateTitle(title, maxWidth, titleSize))))
+	case windowTab:
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>
+`, c.margin, c.margin, c.termWidth, c.barHeight, mixHex(p.bg, "#000000", 0.25)))
+		title = truncateTitle(title, c.termWidth-48, titleSize)
+		tabWidth := max(120, float64(utf8.RuneCountInString(title))*titleSize*0.6+32)
+		tabTop := c.margin + c.barHeight*0.25
+		buf.WriteString(fmt.Sprintf(`<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" rx="6" fill="%s"/>
+`, c.margin+8, tabTop, tabWidth, c.barHeight, p.bg))
+		buf.WriteString(fmt.Sprintf(`<text x="%.1f" y="%.1f" fill="%s" font-family="%s" font-size="%.1fpx" dominant-baseline="middle">%s</text>
+`, c.margin+24, tabTop+c.barHeight*0.375, p.fg, fontFamily, titleSize, html.EscapeString(title)))
+	}
+	buf.WriteString("</g>\n")
+	buf.WriteString(fmt.Sprintf(`<g transform="translate(%.1f,%.1f)">
+`, c.margin, c.margin+c.barHeight))
+}
+
+// writeClose closes the group opened by writeOpen.
+func (c chrome) writeClose(buf *bytes.Buffer) {
+	buf.WriteString("</g>\n")
+}
+
+// truncateTitle shortens title with an ellipsis to fit in width pixels.
+func truncateTitle(title string, width, fontSize float64) string {
+	maxChars := int(width / (fontSize * 0.6))
+	if maxChars < 1 {
+		return ""
+	}
+	if utf8.RuneCountInString(title) <= maxChars {
+		return title
+	}
+	runes := []rune(title)
+	return string(runes[:maxChars-1]) + "…"
+}
+
+// mixHex blends color a towards b by t (0..1). Both are #rrggbb.
+func mixHex(a, b string, t float64) string {
+	ca, cb := parseHex(a), parseHex(b)
+	var out [3]int
+	for i := range out {
+		out[i] = int(float64(ca[i])*(1-t) + float64(cb[i])*t + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", out[0], out[1], out[2])
+}
+
+func parseHex(color string) [3]int {
+	var rgb [3]int
+	if len(color) != 7 || color[0] != '#' {
+		return rgb
+	}
+	for i := range rgb {
+		v, _ := strconv.ParseUint(color[1+i*2:3+i*2], 16, 8)
+		rgb[i] = int(v)
+	}
+	return rgb
+}